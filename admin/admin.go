@@ -0,0 +1,163 @@
+// Package admin implements grpcmetrics.v1.Metrics service that exposes
+// ServerMetrics over gRPC, so they can be inspected with tools like grpcurl
+// when only the gRPC port is reachable.
+package admin
+
+import (
+	"context"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/amenzhinsky/grpcmetrics/metricspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Quantiles reported for handling time histograms.
+var Quantiles = []float64{0.5, 0.9, 0.99}
+
+const (
+	defaultInterval = time.Second
+	minInterval     = 100 * time.Millisecond
+)
+
+func Register(s grpc.ServiceRegistrar, m *grpcmetrics.ServerMetrics) {
+	metricspb.RegisterMetricsServer(s, NewServer(m))
+}
+
+func NewServer(m *grpcmetrics.ServerMetrics) metricspb.MetricsServer {
+	return &server{m: m}
+}
+
+type server struct {
+	metricspb.UnimplementedMetricsServer
+	m *grpcmetrics.ServerMetrics
+}
+
+func (s *server) GetSnapshot(
+	ctx context.Context, req *metricspb.GetSnapshotRequest,
+) (*metricspb.Snapshot, error) {
+	return ToProto(time.Now(), s.m.Snapshot()), nil
+}
+
+func (s *server) Watch(req *metricspb.WatchRequest, stream metricspb.Metrics_WatchServer) error {
+	interval := defaultInterval
+	if req.Interval != nil {
+		if err := req.Interval.CheckValid(); err != nil {
+			return status.Errorf(codes.InvalidArgument, "interval: %s", err)
+		}
+		interval = req.Interval.AsDuration()
+		if interval < minInterval {
+			return status.Errorf(codes.InvalidArgument, "interval must be at least %s", minInterval)
+		}
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var prev []grpcmetrics.MethodStats
+	for {
+		cur := s.m.Snapshot()
+		send := cur
+		if req.Delta && prev != nil {
+			send = grpcmetrics.DiffSnapshots(prev, cur)
+		}
+		if err := stream.Send(ToProto(time.Now(), send)); err != nil {
+			return err
+		}
+		prev = cur
+
+		select {
+		case <-t.C:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+// ToProto converts the given snapshot taken at t into its protobuf representation.
+func ToProto(t time.Time, stats []grpcmetrics.MethodStats) *metricspb.Snapshot {
+	s := &metricspb.Snapshot{
+		Time:    timestamppb.New(t),
+		Methods: make([]*metricspb.MethodStats, 0, len(stats)),
+	}
+	for i := range stats {
+		st := &stats[i]
+		ms := &metricspb.MethodStats{
+			Type:        st.Type,
+			Service:     st.Service,
+			Method:      st.Method,
+			Started:     st.Started,
+			Handled:     make(map[string]uint64, len(st.Handled)),
+			MsgSent:     st.MsgSent,
+			MsgReceived: st.MsgReceived,
+			Panics:      st.Panics,
+		}
+		for code, n := range st.Handled {
+			ms.Handled[code.String()] = n
+		}
+		if st.Handling != nil {
+			ms.Handling = &metricspb.Histogram{
+				Count:   st.Handling.Count,
+				Buckets: make([]*metricspb.Bucket, 0, len(st.Handling.Buckets)),
+			}
+			for _, b := range st.Handling.Buckets {
+				ms.Handling.Buckets = append(ms.Handling.Buckets, &metricspb.Bucket{
+					Lower: b.Lower,
+					Upper: b.Upper,
+					Count: b.Count,
+				})
+			}
+			if st.Handling.Count != 0 {
+				for _, q := range Quantiles {
+					ms.Handling.Quantiles = append(ms.Handling.Quantiles, &metricspb.Quantile{
+						Quantile: q,
+						Value:    st.Handling.Quantile(q),
+					})
+				}
+			}
+		}
+		s.Methods = append(s.Methods, ms)
+	}
+	return s
+}
+
+// FromProto converts the given protobuf snapshot back into method stats.
+func FromProto(s *metricspb.Snapshot) []grpcmetrics.MethodStats {
+	stats := make([]grpcmetrics.MethodStats, 0, len(s.Methods))
+	for _, ms := range s.Methods {
+		st := grpcmetrics.MethodStats{
+			Type:        ms.Type,
+			Service:     ms.Service,
+			Method:      ms.Method,
+			Started:     ms.Started,
+			Handled:     make(map[codes.Code]uint64, len(ms.Handled)),
+			MsgSent:     ms.MsgSent,
+			MsgReceived: ms.MsgReceived,
+			Panics:      ms.Panics,
+		}
+		for name, n := range ms.Handled {
+			code, ok := grpcmetrics.ParseCode(name)
+			if !ok {
+				continue
+			}
+			st.Handled[code] = n
+		}
+		if ms.Handling != nil {
+			st.Handling = &grpcmetrics.HistogramStats{
+				Count:   ms.Handling.Count,
+				Buckets: make([]grpcmetrics.BucketStats, 0, len(ms.Handling.Buckets)),
+			}
+			for _, b := range ms.Handling.Buckets {
+				st.Handling.Buckets = append(st.Handling.Buckets, grpcmetrics.BucketStats{
+					Lower: b.Lower,
+					Upper: b.Upper,
+					Count: b.Count,
+				})
+			}
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
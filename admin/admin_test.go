@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/amenzhinsky/grpcmetrics/metricspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestMetrics(t *testing.T) {
+	m := grpcmetrics.NewServerMetrics(
+		grpcmetrics.WithServerMetricsSet(metrics.NewSet()),
+		grpcmetrics.WithServerHandlingTimeHistogram(true),
+	)
+	cc := dial(t, m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := grpc_health_v1.NewHealthClient(cc).Check(ctx,
+		&grpc_health_v1.HealthCheckRequest{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	c := metricspb.NewMetricsClient(cc)
+	s, err := c.GetSnapshot(ctx, &metricspb.GetSnapshotRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := findMethod(t, s, "grpc.health.v1.Health", "Check")
+	if check.Started != 1 || check.Handled["OK"] != 1 || check.Handling.GetCount() != 1 ||
+		len(check.Handling.Quantiles) != len(Quantiles) {
+		t.Fatalf("unexpected stats: %v", check)
+	}
+
+	stream, err := c.Watch(ctx, &metricspb.WatchRequest{
+		Interval: durationpb.New(minInterval),
+		Delta:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []uint64{1, 0} {
+		s, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := findMethod(t, s, "grpc.health.v1.Health", "Check").Started; n != want {
+			t.Fatalf("started = %d, want %d", n, want)
+		}
+	}
+}
+
+func findMethod(t *testing.T, s *metricspb.Snapshot, service, method string) *metricspb.MethodStats {
+	t.Helper()
+	for _, m := range s.Methods {
+		if m.Service == service && m.Method == method {
+			return m
+		}
+	}
+	t.Fatalf("method /%s/%s not found in %v", service, method, s)
+	return nil
+}
+
+func dial(t *testing.T, m *grpcmetrics.ServerMetrics) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcmetrics.UnaryServerInterceptor(m)),
+		grpc.ChainStreamInterceptor(grpcmetrics.StreamServerInterceptor(m)),
+	)
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	Register(srv, m)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cc.Close()
+	})
+	return cc
+}
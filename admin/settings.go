@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/amenzhinsky/grpcmetrics"
+)
+
+// ServerSettingsHandler serves settings of m that can be changed at runtime,
+// GET returns them as JSON and POST updates the ones passed as form values,
+// e.g. handling_time_histogram=true, and returns the result.
+func ServerSettingsHandler(m *grpcmetrics.ServerMetrics) http.Handler {
+	return &settingsHandler{
+		options: map[string]func(bool) func(){
+			"handling_time_histogram": serverOption(m, grpcmetrics.WithServerHandlingTimeHistogram),
+			"panics_counter":          serverOption(m, grpcmetrics.WithServerPanicsCounter),
+			"termination_label":       serverOption(m, grpcmetrics.WithServerTerminationLabel),
+			"window_stats":            serverOption(m, grpcmetrics.WithServerWindowStats),
+			"window_gauges":           serverOption(m, grpcmetrics.WithServerWindowGauges),
+		},
+		settings: func() interface{} { return m.Settings() },
+	}
+}
+
+// ClientSettingsHandler is the client version of ServerSettingsHandler.
+func ClientSettingsHandler(m *grpcmetrics.ClientMetrics) http.Handler {
+	return &settingsHandler{
+		options: map[string]func(bool) func(){
+			"handling_time_histogram": clientOption(m, grpcmetrics.WithClientHandlingTimeHistogram),
+			"termination_label":       clientOption(m, grpcmetrics.WithClientTerminationLabel),
+			"window_stats":            clientOption(m, grpcmetrics.WithClientWindowStats),
+			"window_gauges":           clientOption(m, grpcmetrics.WithClientWindowGauges),
+		},
+		settings: func() interface{} { return m.Settings() },
+	}
+}
+
+func serverOption(
+	m *grpcmetrics.ServerMetrics, fn func(bool) grpcmetrics.ServerOption,
+) func(bool) func() {
+	return func(enable bool) func() {
+		return func() { m.Update(fn(enable)) }
+	}
+}
+
+func clientOption(
+	m *grpcmetrics.ClientMetrics, fn func(bool) grpcmetrics.ClientOption,
+) func(bool) func() {
+	return func(enable bool) func() {
+		return func() { m.Update(fn(enable)) }
+	}
+}
+
+type settingsHandler struct {
+	options  map[string]func(bool) func()
+	settings func() interface{}
+}
+
+func (h *settingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := h.update(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.settings())
+}
+
+// update validates all form values before applying any of them,
+// they're applied in the order of their names.
+func (h *settingsHandler) update(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(r.Form))
+	for name := range r.Form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var updates []func()
+	for _, name := range names {
+		option, ok := h.options[name]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		values := r.Form[name]
+		enable, err := strconv.ParseBool(values[len(values)-1])
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		updates = append(updates, option(enable))
+	}
+	for _, update := range updates {
+		update()
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/amenzhinsky/grpcmetrics"
+)
+
+func TestServerSettingsHandler(t *testing.T) {
+	m := grpcmetrics.NewServerMetrics(grpcmetrics.WithServerMetricsSet(metrics.NewSet()))
+	srv := httptest.NewServer(ServerSettingsHandler(m))
+	defer srv.Close()
+
+	res, err := http.PostForm(srv.URL, url.Values{
+		"handling_time_histogram": {"true"},
+		"window_stats":            {"1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var s grpcmetrics.ServerSettings
+	if err = json.NewDecoder(res.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.HandlingTimeHistogram || !s.WindowStats || s.WindowGauges || s != m.Settings() {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+
+	for _, v := range []url.Values{
+		{"unknown": {"true"}},
+		{"termination_label": {"maybe"}},
+	} {
+		res, err = http.PostForm(srv.URL, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+		}
+	}
+	if m.Settings().TerminationLabel {
+		t.Fatal("settings are updated by an invalid request")
+	}
+}
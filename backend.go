@@ -0,0 +1,184 @@
+package grpcmetrics
+
+import (
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/amenzhinsky/grpcmetrics/internal/promfmt"
+)
+
+// Backend creates series that metrics are recorded into, series are
+// identified by the metric name and the label set. Factories are called
+// once per series and the returned values are cached, so they may be slow
+// but recording into series has to be safe for concurrent use.
+type Backend interface {
+	Counter(name string, labels []Label) Counter
+	Histogram(name string, labels []Label) Histogram
+	Gauge(name string, labels []Label, f func() float64)
+
+	// Unregister removes a counter or a histogram series.
+	Unregister(name string, labels []Label)
+}
+
+type Label struct {
+	Name, Value string
+}
+
+type Counter interface {
+	Inc()
+	Add(n int)
+	Get() uint64
+}
+
+type Histogram interface {
+	Update(v float64)
+	UpdateDuration(startTime time.Time)
+	Stats() *HistogramStats
+}
+
+// VictoriaMetricsBackend records series into s, when s is nil
+// the default set that metrics.WritePrometheus writes is used.
+func VictoriaMetricsBackend(s *metrics.Set) Backend {
+	return &vmBackend{s}
+}
+
+func WithServerBackend(b Backend) ServerOption {
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerBackend")
+		m.s = b
+	}
+}
+
+func WithClientBackend(b Backend) ClientOption {
+	return func(m *ClientMetrics) {
+		m.mustNotUpdate("WithClientBackend")
+		m.s = b
+	}
+}
+
+type vmBackend struct {
+	s *metrics.Set
+}
+
+// Counter and Histogram panic when the series is already registered,
+// e.g. by another ServerMetrics recording into the same set,
+// series of methods with the same sanitized names are shared by metrics.
+
+func (b *vmBackend) Counter(name string, labels []Label) Counter {
+	if b.s != nil {
+		return b.s.NewCounter(renderName(name, labels))
+	}
+	return metrics.NewCounter(renderName(name, labels))
+}
+
+func (b *vmBackend) Histogram(name string, labels []Label) Histogram {
+	if b.s != nil {
+		return &vmHistogram{Histogram: b.s.NewHistogram(renderName(name, labels))}
+	}
+	return &vmHistogram{Histogram: metrics.NewHistogram(renderName(name, labels))}
+}
+
+func (b *vmBackend) Gauge(name string, labels []Label, f func() float64) {
+	if b.s != nil {
+		b.s.GetOrCreateGauge(renderName(name, labels), f)
+		return
+	}
+	metrics.GetOrCreateGauge(renderName(name, labels), f)
+}
+
+func (b *vmBackend) Unregister(name string, labels []Label) {
+	if b.s != nil {
+		b.s.UnregisterMetric(renderName(name, labels))
+		return
+	}
+	metrics.UnregisterMetric(renderName(name, labels))
+}
+
+// vmHistogram keeps the sum of observations,
+// because VictoriaMetrics histograms don't expose it.
+type vmHistogram struct {
+	*metrics.Histogram
+	sum uint64 // float64 bits
+}
+
+func (h *vmHistogram) Update(v float64) {
+	h.Histogram.Update(v)
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		if atomic.CompareAndSwapUint64(&h.sum, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (h *vmHistogram) UpdateDuration(startTime time.Time) {
+	h.Update(time.Since(startTime).Seconds())
+}
+
+func (h *vmHistogram) Stats() *HistogramStats {
+	s := &HistogramStats{Sum: math.Float64frombits(atomic.LoadUint64(&h.sum))}
+	h.VisitNonZeroBuckets(func(vmrange string, count uint64) {
+		lower, upper, ok := promfmt.ParseVMRange(vmrange)
+		if !ok {
+			return
+		}
+		s.Count += count
+		s.Buckets = append(s.Buckets, BucketStats{lower, upper, count})
+	})
+	return s
+}
+
+// renderName renders the series name in the prometheus text format.
+func renderName(name string, labels []Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.Grow(1024) // should be enough for almost all metric names
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		writeLabelValue(&b, l.Value)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// parseLabels parses a comma-separated list of labels rendered by renderLabels.
+func parseLabels(s string) []Label {
+	var labels []Label
+	for s != "" {
+		i := strings.Index(s, `="`)
+		if i == -1 {
+			break
+		}
+		name := s[:i]
+		s = s[i+2:]
+		var b strings.Builder
+		for len(s) != 0 && s[0] != '"' {
+			if s[0] == '\\' && len(s) > 1 {
+				if s[1] == 'n' {
+					b.WriteByte('\n')
+				} else {
+					b.WriteByte(s[1])
+				}
+				s = s[2:]
+				continue
+			}
+			b.WriteByte(s[0])
+			s = s[1:]
+		}
+		labels = append(labels, Label{name, b.String()})
+		s = strings.TrimPrefix(strings.TrimPrefix(s, `"`), ",")
+	}
+	return labels
+}
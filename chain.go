@@ -0,0 +1,105 @@
+package grpcmetrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerHandlerInterceptor marks the end of the interceptor chain, it goes
+// at the innermost position while UnaryServerInterceptor(m) goes at the outermost,
+// together they split the handling time into:
+//
+//   - grpc_server_handling_middleware_seconds, time spent in interceptors in between,
+//     calls rejected by them are accounted here as well
+//   - grpc_server_handling_handler_seconds, time spent in handlers
+//
+// It must be created before the server starts.
+func UnaryServerHandlerInterceptor(m *ServerMetrics) grpc.UnaryServerInterceptor {
+	m.chainTiming()
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ct, _ := ctx.Value(chainTimesKey{}).(*chainTimes)
+		if ct == nil {
+			return handler(ctx, req)
+		}
+		ct.handlerStart = time.Now()
+		res, err := handler(ctx, req)
+		ct.handlerEnd = time.Now()
+		return res, err
+	}
+}
+
+// StreamServerHandlerInterceptor is the stream version of UnaryServerHandlerInterceptor.
+func StreamServerHandlerInterceptor(m *ServerMetrics) grpc.StreamServerInterceptor {
+	m.chainTiming()
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ct, _ := ss.Context().Value(chainTimesKey{}).(*chainTimes)
+		if ct == nil {
+			return handler(srv, ss)
+		}
+		ct.handlerStart = time.Now()
+		err := handler(srv, ss)
+		ct.handlerEnd = time.Now()
+		return err
+	}
+}
+
+func (m *ServerMetrics) chainTiming() {
+	if m.chain != nil {
+		return
+	}
+	m.chain = &chain{
+		middleware: newHistogram("grpc_server_handling_middleware_seconds"),
+		handler:    newHistogram("grpc_server_handling_handler_seconds"),
+	}
+	m.expirer.track(m.chain.middleware.metric)
+	m.expirer.track(m.chain.handler.metric)
+}
+
+type chain struct {
+	middleware, handler *histogram
+}
+
+// chainTimes are set by the handler interceptor and read by the outer one
+// after the chain returns, both run in the same goroutine.
+type chainTimes struct {
+	startedAt    time.Time
+	handlerStart time.Time
+	handlerEnd   time.Time
+}
+
+type chainTimesKey struct{}
+
+// enter returns ctx that carries timestamps for the handler interceptor,
+// it's a no-op when the handler interceptor isn't used.
+func (c *chain) enter(ctx context.Context) (context.Context, *chainTimes) {
+	if c == nil {
+		return ctx, nil
+	}
+	ct := &chainTimes{startedAt: time.Now()}
+	return context.WithValue(ctx, chainTimesKey{}, ct), ct
+}
+
+func (c *chain) exit(s Backend, typ, method string, ct *chainTimes) {
+	if ct == nil {
+		return
+	}
+	total := time.Since(ct.startedAt)
+	var handler time.Duration
+	if !ct.handlerEnd.IsZero() {
+		handler = ct.handlerEnd.Sub(ct.handlerStart)
+		c.handler.with(s, typ, method).Update(handler.Seconds())
+	}
+	c.middleware.with(s, typ, method).Update((total - handler).Seconds())
+}
@@ -0,0 +1,62 @@
+package grpcmetrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerHandlerInterceptor(t *testing.T) {
+	m := newServerMetrics()
+	inner := UnaryServerHandlerInterceptor(m)
+	chain := func(reject bool) {
+		info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+		_, _ = UnaryServerInterceptor(m)(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			// middleware
+			time.Sleep(20 * time.Millisecond)
+			if reject {
+				return nil, status.Error(codes.Unauthenticated, "")
+			}
+			return inner(ctx, req, info, func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+		})
+	}
+	chain(false)
+	chain(true)
+
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handling_middleware_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 2`,
+		`grpc_server_handling_handler_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+	)
+	for _, s := range m.chain.middleware.seriesOf(m.s) {
+		if q := s.v.(Histogram).Stats().Quantile(0); q < 0.015 {
+			t.Fatalf("middleware time = %f, want at least 20ms", q)
+		}
+	}
+	checkExposed(t, m,
+		"grpc_server_handling_middleware_seconds",
+		"grpc_server_handling_handler_seconds",
+	)
+}
+
+func TestStreamServerHandlerInterceptor(t *testing.T) {
+	m := newServerMetrics()
+	inner := StreamServerHandlerInterceptor(m)
+	info := &grpc.StreamServerInfo{FullMethod: "/grpc.health.v1.Health/Watch", IsServerStream: true}
+	if err := StreamServerInterceptor(m)(nil, &fakeServerStream{}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return inner(srv, ss, info, func(interface{}, grpc.ServerStream) error {
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handling_middleware_seconds_count{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
+		`grpc_server_handling_handler_seconds_count{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
+	)
+}
@@ -2,52 +2,169 @@ package grpcmetrics
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 type ClientOption func(m *ClientMetrics)
 
 func WithClientHandlingTimeHistogram(enable bool) ClientOption {
 	return func(m *ClientMetrics) {
-		if enable {
+		if !enable {
+			m.next.handling = nil
+			return
+		}
+		if m.handling == nil {
 			m.handling = newHistogram("grpc_client_handling_seconds")
+			m.expirer.track(m.handling.metric)
 		}
+		m.next.handling = m.handling
+	}
+}
+
+// WithClientTerminationLabel adds grpc_termination label to grpc_client_handled_total
+// that distinguishes calls canceled or timed out by the caller from the ones
+// that failed remotely with the same codes.
+func WithClientTerminationLabel(enable bool) ClientOption {
+	return func(m *ClientMetrics) {
+		m.next.termination = enable
 	}
 }
 
 func WithClientMetricsSet(s *metrics.Set) ClientOption {
 	return func(m *ClientMetrics) {
-		m.s = &set{s}
+		m.mustNotUpdate("WithClientMetricsSet")
+		m.s = &vmBackend{s}
 	}
 }
 
 func NewClientMetrics(opts ...ClientOption) *ClientMetrics {
 	m := &ClientMetrics{
-		s:       &set{},
+		s:       &vmBackend{},
 		started: newCounter("grpc_client_started_total"),
 		handled: newCounter("grpc_client_handled_total"),
 		msgRecv: newCounter("grpc_client_msg_received_total"),
 		msgSent: newCounter("grpc_client_msg_sent_total"),
 	}
-	for _, opt := range opts {
-		opt(m)
+	m.cfg.Store(&clientConfig{})
+	m.apply(false, opts)
+	if m.ttl > 0 {
+		m.expirer = newExpirer(m.ttl, m.s, "grpc_client_series_expired_total",
+			m.started.metric, m.handled.metric, m.msgRecv.metric, m.msgSent.metric,
+			m.handling.metricOrNil(),
+		)
+		m.expirer.trackWindows(m.windows)
 	}
 	return m
 }
 
 type ClientMetrics struct {
-	s        *set
-	started  *counter
-	handled  *counter
-	msgRecv  *counter
-	msgSent  *counter
+	s       Backend
+	started *counter
+	handled *counter
+	msgRecv *counter
+	msgSent *counter
+	ttl     time.Duration
+	expirer *expirer
+
+	mu       sync.Mutex   // serializes updates
+	cfg      atomic.Value // *clientConfig
+	next     *clientConfig
+	updating bool
+
+	// optional metrics are kept when they're disabled by Update,
+	// so enabling them again continues the same series
 	handling *histogram
+	windows  *windows
+}
+
+// clientConfig contains settings that can be changed by Update,
+// every call uses the config that is current when the call starts.
+type clientConfig struct {
+	handling    *histogram
+	termination bool
+	windows     *windows
+}
+
+func (m *ClientMetrics) config() *clientConfig {
+	return m.cfg.Load().(*clientConfig)
+}
+
+// InitializeMetrics pre-populates client metrics with methods of the given services.
+func (m *ClientMetrics) InitializeMetrics(descs ...grpc.ServiceDesc) {
+	for i := range descs {
+		for _, method := range descs[i].Methods {
+			m.initializeMethod(unary, "/"+descs[i].ServiceName+"/"+method.MethodName)
+		}
+		for _, stream := range descs[i].Streams {
+			m.initializeMethod(
+				streamType(stream.ServerStreams, stream.ClientStreams),
+				"/"+descs[i].ServiceName+"/"+stream.StreamName,
+			)
+		}
+	}
+}
+
+// InitializeMetricsFromRegistry is like InitializeMetrics but looks up
+// the named services in protoregistry.GlobalFiles, so the generated
+// code of the services has to be linked into the binary.
+func (m *ClientMetrics) InitializeMetricsFromRegistry(services ...string) error {
+	for _, name := range services {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return fmt.Errorf("%s is not a service", name)
+		}
+		m.initializeService(sd)
+	}
+	return nil
+}
+
+func (m *ClientMetrics) initializeService(sd protoreflect.ServiceDescriptor) {
+	methods := sd.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		m.initializeMethod(
+			streamType(md.IsStreamingServer(), md.IsStreamingClient()),
+			"/"+string(sd.FullName())+"/"+string(md.Name()),
+		)
+	}
+}
+
+func (m *ClientMetrics) initializeMethod(typ, fullMethod string) {
+	c := m.config()
+	m.started.pin(m.s, typ, fullMethod, noCode, "")
+	m.msgRecv.pin(m.s, typ, fullMethod, noCode, "")
+	if typ == unary {
+		// unary interceptor counts sent messages only for successful calls
+		m.msgSent.pin(m.s, typ, fullMethod, codes.OK, "")
+	} else {
+		m.msgSent.pin(m.s, typ, fullMethod, noCode, "")
+	}
+	if c.termination {
+		forEachTermination(func(code codes.Code, labels string) {
+			m.handled.pin(m.s, typ, fullMethod, code, labels)
+		})
+	} else {
+		for _, code := range allCodes {
+			m.handled.pin(m.s, typ, fullMethod, code, "")
+		}
+	}
+	if c.handling != nil {
+		c.handling.pin(m.s, typ, fullMethod, "")
+	}
 }
 
 func UnaryClientInterceptor(m *ClientMetrics) grpc.UnaryClientInterceptor {
@@ -59,20 +176,24 @@ func UnaryClientInterceptor(m *ClientMetrics) grpc.UnaryClientInterceptor {
 		invoker grpc.UnaryInvoker,
 		opts ...grpc.CallOption,
 	) error {
+		c := m.config()
 		var startedAt time.Time
-		if m.handling != nil {
+		if c.handling != nil || c.windows != nil {
 			startedAt = time.Now()
 		}
 		m.started.with(m.s, unary, fullMethod, noCode).Inc()
 		m.msgRecv.with(m.s, unary, fullMethod, noCode).Inc()
 		err := invoker(ctx, fullMethod, req, reply, cc, opts...)
-		code := status.Code(err)
-		m.handled.with(m.s, unary, fullMethod, code).Inc()
+		code := errorCode(err)
+		m.handled.withLabels(m.s, unary, fullMethod, code, c.handledLabels(ctx, code)).Inc()
 		if err == nil {
 			m.msgSent.with(m.s, unary, fullMethod, code).Inc()
 		}
-		if m.handling != nil {
-			m.handling.with(m.s, unary, fullMethod).UpdateDuration(startedAt)
+		if c.handling != nil {
+			c.handling.with(m.s, unary, fullMethod).UpdateDuration(startedAt)
+		}
+		if c.windows != nil {
+			c.windows.observe(unary, fullMethod, code, startedAt)
 		}
 		return err
 	}
@@ -87,20 +208,27 @@ func StreamClientInterceptor(m *ClientMetrics) grpc.StreamClientInterceptor {
 		streamer grpc.Streamer,
 		opts ...grpc.CallOption,
 	) (grpc.ClientStream, error) {
+		c := m.config()
 		var startedAt time.Time
-		if m.handling != nil {
+		if c.handling != nil || c.windows != nil {
 			startedAt = time.Now()
 		}
 		typ := streamType(desc.ServerStreams, desc.ClientStreams)
 		m.started.with(m.s, typ, fullMethod, noCode).Inc()
 		cs, err := streamer(ctx, desc, cc, fullMethod, opts...)
 		if err != nil {
-			m.handled.with(m.s, typ, fullMethod, status.Code(err)).Inc()
+			code := errorCode(err)
+			m.handled.withLabels(m.s, typ, fullMethod, code, c.handledLabels(ctx, code)).Inc()
+			if c.windows != nil {
+				c.windows.observe(typ, fullMethod, code, startedAt)
+			}
 			return nil, err
 		}
 		return &clientStream{
 			cs,
+			ctx,
 			m,
+			c,
 			typ,
 			fullMethod,
 			startedAt,
@@ -108,10 +236,22 @@ func StreamClientInterceptor(m *ClientMetrics) grpc.StreamClientInterceptor {
 	}
 }
 
+// handledLabels returns extra labels for grpc_client_handled_total.
+func (c *clientConfig) handledLabels(ctx context.Context, code codes.Code) string {
+	if c.termination {
+		return termination(ctx, code)
+	}
+	return ""
+}
+
 type clientStream struct {
 	grpc.ClientStream
 
+	// ctx is the caller's context, the stream's one
+	// is canceled by grpc when the stream is finished
+	ctx         context.Context
 	m           *ClientMetrics
+	c           *clientConfig
 	typ, method string
 	startedAt   time.Time
 }
@@ -132,11 +272,14 @@ func (cs *clientStream) RecvMsg(m interface{}) error {
 	}
 	code := codes.OK
 	if err != io.EOF {
-		code = status.Code(err)
+		code = errorCode(err)
+	}
+	cs.m.handled.withLabels(cs.m.s, cs.typ, cs.method, code, cs.c.handledLabels(cs.ctx, code)).Inc()
+	if cs.c.handling != nil {
+		cs.c.handling.with(cs.m.s, cs.typ, cs.method).UpdateDuration(cs.startedAt)
 	}
-	cs.m.handled.with(cs.m.s, cs.typ, cs.method, code).Inc()
-	if cs.m.handling != nil {
-		cs.m.handling.with(cs.m.s, cs.typ, cs.method).UpdateDuration(cs.startedAt)
+	if cs.c.windows != nil {
+		cs.c.windows.observe(cs.typ, cs.method, code, cs.startedAt)
 	}
 	return err
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -26,7 +27,7 @@ func TestUnaryClientInterceptor(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	checkContains(t, m.s.Set,
+	checkContains(t, vmSet(m.s),
 		`grpc_client_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 1`,
 		`grpc_client_msg_received_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
 		`grpc_client_msg_sent_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 1`,
@@ -64,7 +65,7 @@ func TestStreamClientInterceptor(t *testing.T) {
 		t.Fatalf("err = %v, want %v", err, io.EOF)
 	}
 
-	checkContains(t, m.s.Set,
+	checkContains(t, vmSet(m.s),
 		`grpc_client_handled_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch",grpc_code="OK"} 1`,
 		`grpc_client_msg_received_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
 		`grpc_client_msg_sent_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
@@ -72,8 +73,65 @@ func TestStreamClientInterceptor(t *testing.T) {
 	)
 }
 
+func TestUnaryClientInterceptor_Termination(t *testing.T) {
+	m := NewClientMetrics(
+		WithClientMetricsSet(metrics.NewSet()),
+		WithClientTerminationLabel(true),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if err := UnaryClientInterceptor(m)(
+		ctx, "/grpc.health.v1.Health/Check", nil, nil, nil,
+		func(
+			ctx context.Context, method string,
+			req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption,
+		) error {
+			return ctx.Err()
+		},
+	); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	checkContains(t, vmSet(m.s),
+		`grpc_client_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="DeadlineExceeded",grpc_termination="deadline_exceeded"} 1`,
+	)
+}
+
+func TestClientMetrics_InitializeMetrics(t *testing.T) {
+	m := newClientMetrics()
+	m.InitializeMetrics(grpc_health_v1.Health_ServiceDesc)
+	checkContains(t, vmSet(m.s),
+		`grpc_client_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
+		`grpc_client_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="Unavailable"} 0`,
+		`grpc_client_msg_sent_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 0`,
+		`grpc_client_started_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 0`,
+		`grpc_client_msg_received_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 0`,
+		`grpc_client_handled_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch",grpc_code="OK"} 0`,
+	)
+}
+
+func TestClientMetrics_InitializeMetricsFromRegistry(t *testing.T) {
+	m := newClientMetrics()
+	if err := m.InitializeMetricsFromRegistry("grpc.health.v1.Health"); err != nil {
+		t.Fatal(err)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_client_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
+		`grpc_client_started_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 0`,
+	)
+	for _, name := range []string{
+		"grpc.health.v1.Unknown",
+		"grpc.health.v1.HealthCheckRequest",
+	} {
+		if err := m.InitializeMetricsFromRegistry(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
 func BenchmarkScrapeClient_metrics(b *testing.B) {
-	benchScrape(b, newClientMetrics().s)
+	benchScrape(b, vmSet(newClientMetrics().s))
 }
 
 func BenchmarkScrapeClient_client_golang(b *testing.B) {
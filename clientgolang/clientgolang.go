@@ -0,0 +1,189 @@
+// Package clientgolang records grpcmetrics series into prometheus/client_golang metrics.
+//
+//	b := clientgolang.New(prometheus.DefBuckets)
+//	prometheus.MustRegister(b)
+//	m := grpcmetrics.NewServerMetrics(grpcmetrics.WithServerBackend(b))
+package clientgolang
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Backend is both a grpcmetrics.Backend and a prometheus.Collector.
+//
+// It's an unchecked collector, because label sets of a metric may change
+// at runtime, e.g. when the termination label is enabled by Update.
+type Backend struct {
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]prometheus.Collector
+}
+
+// New creates a backend, histograms have the given buckets,
+// prometheus.DefBuckets are used when it's empty.
+func New(buckets []float64) *Backend {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return &Backend{
+		buckets: buckets,
+		series:  map[string]prometheus.Collector{},
+	}
+}
+
+func (b *Backend) Counter(name string, labels []grpcmetrics.Label) grpcmetrics.Counter {
+	c := b.getOrCreate(name, labels, func(opts prometheus.Opts) prometheus.Collector {
+		return prometheus.NewCounter(prometheus.CounterOpts(opts))
+	})
+	return counter{c.(prometheus.Counter)}
+}
+
+func (b *Backend) Histogram(name string, labels []grpcmetrics.Label) grpcmetrics.Histogram {
+	h := b.getOrCreate(name, labels, func(opts prometheus.Opts) prometheus.Collector {
+		return prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        opts.Name,
+			Help:        opts.Help,
+			ConstLabels: opts.ConstLabels,
+			Buckets:     b.buckets,
+		})
+	})
+	return histogram{h.(prometheus.Histogram)}
+}
+
+func (b *Backend) Gauge(name string, labels []grpcmetrics.Label, f func() float64) {
+	b.getOrCreate(name, labels, func(opts prometheus.Opts) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts(opts), f)
+	})
+}
+
+func (b *Backend) Unregister(name string, labels []grpcmetrics.Label) {
+	b.mu.Lock()
+	delete(b.series, key(name, labels))
+	b.mu.Unlock()
+}
+
+func (b *Backend) getOrCreate(
+	name string, labels []grpcmetrics.Label, new func(opts prometheus.Opts) prometheus.Collector,
+) prometheus.Collector {
+	k := key(name, labels)
+	b.mu.RLock()
+	c, ok := b.series[k]
+	b.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok = b.series[k]; ok {
+		return c
+	}
+	constLabels := make(prometheus.Labels, len(labels))
+	for _, l := range labels {
+		constLabels[l.Name] = l.Value
+	}
+	help := grpcmetrics.Help(name)
+	if help == "" {
+		help = name
+	}
+	c = new(prometheus.Opts{Name: name, Help: help, ConstLabels: constLabels})
+	b.series[k] = c
+	return c
+}
+
+// Describe sends nothing, so the collector is unchecked.
+func (b *Backend) Describe(chan<- *prometheus.Desc) {}
+
+func (b *Backend) Collect(ch chan<- prometheus.Metric) {
+	b.mu.RLock()
+	list := make([]prometheus.Collector, 0, len(b.series))
+	for _, c := range b.series {
+		list = append(list, c)
+	}
+	b.mu.RUnlock()
+	for _, c := range list {
+		c.Collect(ch)
+	}
+}
+
+func key(name string, labels []grpcmetrics.Label) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, l := range labels {
+		b.WriteByte(0xff)
+		b.WriteString(l.Name)
+		b.WriteByte(0xff)
+		b.WriteString(l.Value)
+	}
+	return b.String()
+}
+
+type counter struct {
+	prometheus.Counter
+}
+
+func (c counter) Add(n int) {
+	c.Counter.Add(float64(n))
+}
+
+func (c counter) Get() uint64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return uint64(m.GetCounter().GetValue())
+}
+
+type histogram struct {
+	prometheus.Histogram
+}
+
+func (h histogram) Update(v float64) {
+	h.Observe(v)
+}
+
+func (h histogram) UpdateDuration(startTime time.Time) {
+	h.Observe(time.Since(startTime).Seconds())
+}
+
+// Stats converts cumulative buckets into non-cumulative ones,
+// observations above the last bucket fall into the +Inf one.
+func (h histogram) Stats() *grpcmetrics.HistogramStats {
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		return &grpcmetrics.HistogramStats{}
+	}
+	buckets := m.GetHistogram().GetBucket()
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].GetUpperBound() < buckets[j].GetUpperBound()
+	})
+	s := &grpcmetrics.HistogramStats{
+		Count: m.GetHistogram().GetSampleCount(),
+		Sum:   m.GetHistogram().GetSampleSum(),
+	}
+	var lower float64
+	var seen uint64
+	for _, b := range buckets {
+		if n := b.GetCumulativeCount() - seen; n != 0 {
+			s.Buckets = append(s.Buckets, grpcmetrics.BucketStats{
+				Lower: lower, Upper: b.GetUpperBound(), Count: n,
+			})
+		}
+		lower, seen = b.GetUpperBound(), b.GetCumulativeCount()
+	}
+	if n := s.Count - seen; n != 0 {
+		s.Buckets = append(s.Buckets, grpcmetrics.BucketStats{
+			Lower: lower, Upper: math.Inf(1), Count: n,
+		})
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package clientgolang
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackend(t *testing.T) {
+	b := New([]float64{1})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(b)
+
+	m := grpcmetrics.NewServerMetrics(
+		grpcmetrics.WithServerBackend(b),
+		grpcmetrics.WithServerHandlingTimeHistogram(true),
+	)
+	call := func(err error) {
+		_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+	call(nil)
+	call(status.Error(codes.NotFound, ""))
+
+	// label sets of the same metric differ after enabling the termination label
+	m.Update(grpcmetrics.WithServerTerminationLabel(true))
+	call(nil)
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_code="NotFound",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 1
+grpc_server_handled_total{grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 1
+grpc_server_handled_total{grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_termination="completed",grpc_type="unary"} 1
+`), "grpc_server_handled_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := m.Snapshot()
+	if len(s) != 1 || s[0].Started != 3 || s[0].Handling.Count != 3 {
+		t.Fatalf("unexpected snapshot: %+v", s)
+	}
+}
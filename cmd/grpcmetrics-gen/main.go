@@ -0,0 +1,73 @@
+// Command grpcmetrics-gen generates Grafana dashboards and Prometheus/vmalert
+// recording and alerting rules for series produced by grpcmetrics:
+//
+//	grpcmetrics-gen -namespace prod -services grpc.health.v1.Health dashboard > dashboard.json
+//	grpcmetrics-gen -histogram le -error-ratio 0.05 -latency 250ms rules > rules.yml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/amenzhinsky/grpcmetrics/mixin"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	c := mixin.DefaultConfig()
+	var histogram, errorCodes, services string
+
+	f := flag.NewFlagSet("grpcmetrics-gen", flag.ContinueOnError)
+	f.StringVar(&c.Prefix, "prefix", c.Prefix, "metric names `prefix`, grpc_server or grpc_client")
+	f.StringVar(&c.Namespace, "namespace", c.Namespace, "metric names `namespace`, prepended to the prefix")
+	f.StringVar(&c.Selector, "selector", c.Selector, "extra label `matchers`, e.g. job=\"api\"")
+	f.StringVar(&histogram, "histogram", string(c.Histogram), "histogram `kind`, vmrange or le")
+	f.StringVar(&errorCodes, "error-codes", strings.Join(c.ErrorCodes, ","), "comma-separated `codes` counted as errors")
+	f.Float64Var(&c.ErrorRatio, "error-ratio", c.ErrorRatio, "error `ratio` SLO threshold")
+	f.Float64Var(&c.LatencyQuantile, "latency-quantile", c.LatencyQuantile, "latency SLO `quantile`")
+	f.DurationVar(&c.LatencyThreshold, "latency", c.LatencyThreshold, "latency SLO `threshold`, 0 disables latency rules")
+	f.DurationVar(&c.Window, "window", c.Window, "rate `window`")
+	f.StringVar(&services, "services", "", "comma-separated `services` to generate dashboard rows for")
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "Usage: grpcmetrics-gen [option...] dashboard|rules\n")
+		f.PrintDefaults()
+	}
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	if f.NArg() != 1 {
+		f.Usage()
+		return fmt.Errorf("exactly one of dashboard or rules is expected")
+	}
+
+	c.Histogram = mixin.HistogramKind(histogram)
+	c.ErrorCodes = split(errorCodes)
+	c.Services = split(services)
+	switch f.Arg(0) {
+	case "dashboard":
+		return mixin.Dashboard(w, c)
+	case "rules":
+		return mixin.Rules(w, c)
+	default:
+		return fmt.Errorf("unknown output %q", f.Arg(0))
+	}
+}
+
+func split(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestRun(t *testing.T) {
+	for _, c := range []struct {
+		golden string
+		args   []string
+	}{
+		{"dashboard.json", []string{"-namespace", "prod", "-services", "grpc.health.v1.Health", "dashboard"}},
+		{"rules.yml", []string{"-namespace", "prod", "-histogram", "le", "-error-ratio", "0.05", "-latency", "250ms", "rules"}},
+		{"client_rules.yml", []string{"-prefix", "grpc_client", "-selector", `job="api"`, "-latency", "0", "rules"}},
+	} {
+		t.Run(c.golden, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := run(c.args, &b); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", c.golden)
+			if *update {
+				if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%s, run with -update to create it", err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Fatalf("output differs from %s, run with -update to see the diff:\n%s", path, b.String())
+			}
+		})
+	}
+}
+
+func TestRun_invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-namespace", "prod-eu", "rules"},
+		{"-histogram", "summary", "rules"},
+		{"alerts"},
+	} {
+		if err := run(args, &bytes.Buffer{}); err == nil {
+			t.Errorf("run(%q) doesn't fail", args)
+		}
+	}
+}
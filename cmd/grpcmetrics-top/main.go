@@ -0,0 +1,166 @@
+// Command grpcmetrics-top shows a continuously refreshing table of gRPC methods
+// with their request rates, error ratios, latencies and in-flight calls.
+//
+// Metrics are polled either from a prometheus /metrics endpoint or
+// from the grpcmetrics.v1.Metrics admin service:
+//
+//	grpcmetrics-top -url http://localhost:8080/metrics
+//	grpcmetrics-top -addr localhost:9090 -sort p99
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/amenzhinsky/grpcmetrics/admin"
+	"github.com/amenzhinsky/grpcmetrics/metricspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	interval time.Duration
+	sortBy   string
+	limit    int
+	count    int
+	clear    bool
+}
+
+func run() error {
+	var (
+		urlFlag    = flag.String("url", "", "prometheus metrics `url` to poll")
+		addrFlag   = flag.String("addr", "", "grpc `address` serving grpcmetrics.v1.Metrics service")
+		prefixFlag = flag.String("prefix", "grpc_server", "metric names `prefix`, grpc_server or grpc_client")
+		opts       options
+	)
+	flag.DurationVar(&opts.interval, "interval", 2*time.Second, "refresh `interval`")
+	flag.StringVar(&opts.sortBy, "sort", "rps", "sort by `column`: method, rps, err, p50, p99 or inflight")
+	flag.IntVar(&opts.limit, "n", 0, "show only top `n` methods")
+	flag.IntVar(&opts.count, "count", 0, "exit after `n` refreshes")
+	flag.BoolVar(&opts.clear, "clear", true, "clear screen before every refresh")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -url URL|-addr ADDR [option...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if _, ok := columns[opts.sortBy]; !ok {
+		return fmt.Errorf("unknown sort column %q", opts.sortBy)
+	}
+
+	var src source
+	switch {
+	case *urlFlag != "" && *addrFlag == "":
+		src = &httpSource{url: *urlFlag, prefix: *prefixFlag}
+	case *addrFlag != "" && *urlFlag == "":
+		cc, err := grpc.Dial(*addrFlag, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer cc.Close()
+		src = &adminSource{c: metricspb.NewMetricsClient(cc)}
+	default:
+		return errors.New("exactly one of -url and -addr is required")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if err := top(ctx, src, os.Stdout, &opts); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func top(ctx context.Context, src source, w io.Writer, opts *options) error {
+	prev, err := src.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	prevAt := time.Now()
+
+	t := time.NewTicker(opts.interval)
+	defer t.Stop()
+	for i := 0; opts.count == 0 || i < opts.count; i++ {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		cur, err := src.fetch(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		rows := buildRows(prev, cur, now.Sub(prevAt))
+		if err := sortRows(rows, opts.sortBy); err != nil {
+			return err
+		}
+		if opts.clear {
+			fmt.Fprint(w, "\033[H\033[2J")
+		}
+		fmt.Fprintf(w, "%s, sorted by %s\n\n", now.Format(time.RFC3339), opts.sortBy)
+		if err := render(w, rows, opts.limit); err != nil {
+			return err
+		}
+		prev, prevAt = cur, now
+	}
+	return nil
+}
+
+type source interface {
+	fetch(ctx context.Context) ([]grpcmetrics.MethodStats, error)
+}
+
+type httpSource struct {
+	url    string
+	prefix string
+}
+
+func (s *httpSource) fetch(ctx context.Context) ([]grpcmetrics.MethodStats, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("GET %s: %s: %s", s.url, res.Status, strings.TrimSpace(string(b)))
+	}
+	return parseExposition(res.Body, s.prefix)
+}
+
+type adminSource struct {
+	c metricspb.MetricsClient
+}
+
+func (s *adminSource) fetch(ctx context.Context) ([]grpcmetrics.MethodStats, error) {
+	res, err := s.c.GetSnapshot(ctx, &metricspb.GetSnapshotRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return admin.FromProto(res), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/amenzhinsky/grpcmetrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTop(t *testing.T) {
+	s := metrics.NewSet()
+	m := grpcmetrics.NewServerMetrics(
+		grpcmetrics.WithServerMetricsSet(s),
+		grpcmetrics.WithServerHandlingTimeHistogram(true),
+	)
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches != 0 {
+			for _, err := range []error{nil, nil, nil, status.Error(codes.NotFound, "")} {
+				_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+					FullMethod: "/grpc.health.v1.Health/Check",
+				}, func(context.Context, interface{}) (interface{}, error) {
+					return nil, err
+				})
+			}
+		}
+		fetches++
+		s.WritePrometheus(w)
+	}))
+	defer srv.Close()
+
+	var b bytes.Buffer
+	if err := top(context.Background(), &httpSource{
+		url:    srv.URL,
+		prefix: "grpc_server",
+	}, &b, &options{
+		interval: 10 * time.Millisecond,
+		sortBy:   "rps",
+		count:    1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+	fields := strings.Fields(lines[3])
+	if len(fields) != 8 || fields[0] != "/grpc.health.v1.Health/Check" ||
+		fields[3] != "25.00" || !strings.HasPrefix(fields[7], "NotFound:") {
+		t.Fatalf("unexpected row: %q", fields)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/amenzhinsky/grpcmetrics/internal/promfmt"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc/codes"
+)
+
+// parseExposition extracts method stats of series with the given prefix,
+// e.g. grpc_server, from the prometheus text exposition format.
+//
+// Handling time histograms are accepted both in VictoriaMetrics
+// vmrange and classic cumulative le bucket forms.
+func parseExposition(r io.Reader, prefix string) ([]grpcmetrics.MethodStats, error) {
+	var p expfmt.TextParser
+	families, err := p.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]*grpcmetrics.MethodStats{}
+	// cumulative le buckets are accumulated per series, because
+	// a method can have multiple series with different labels
+	les := map[leSeries][]grpcmetrics.BucketStats{}
+	get := func(m *dto.Metric) *grpcmetrics.MethodStats {
+		service, method := label(m, "grpc_service"), label(m, "grpc_method")
+		key := "/" + service + "/" + method
+		s, ok := stats[key]
+		if !ok {
+			s = &grpcmetrics.MethodStats{
+				Type:    label(m, "grpc_type"),
+				Service: service,
+				Method:  method,
+				Handled: map[codes.Code]uint64{},
+			}
+			stats[key] = s
+		}
+		return s
+	}
+
+	for name, f := range families {
+		suffix := strings.TrimPrefix(name, prefix+"_")
+		if suffix == name {
+			continue
+		}
+		for _, m := range f.Metric {
+			if label(m, "grpc_service") == "" {
+				continue
+			}
+			switch suffix {
+			case "started_total":
+				get(m).Started += value(f, m)
+			case "handled_total":
+				code, ok := grpcmetrics.ParseCode(label(m, "grpc_code"))
+				if !ok {
+					return nil, fmt.Errorf("unknown grpc_code %q", label(m, "grpc_code"))
+				}
+				get(m).Handled[code] += value(f, m)
+			case "msg_sent_total":
+				get(m).MsgSent += value(f, m)
+			case "msg_received_total":
+				get(m).MsgReceived += value(f, m)
+			case "panics_total":
+				get(m).Panics += value(f, m)
+			case "handling_seconds_bucket":
+				s := get(m)
+				if s.Handling == nil {
+					s.Handling = &grpcmetrics.HistogramStats{}
+				}
+				if vmrange := label(m, "vmrange"); vmrange != "" {
+					lower, upper, ok := promfmt.ParseVMRange(vmrange)
+					if !ok {
+						return nil, fmt.Errorf("malformed vmrange %q", vmrange)
+					}
+					n := value(f, m)
+					s.Handling.Count += n
+					s.Handling.Buckets = append(s.Handling.Buckets, grpcmetrics.BucketStats{
+						Lower: lower, Upper: upper, Count: n,
+					})
+				} else if le := label(m, "le"); le != "" {
+					upper, err := strconv.ParseFloat(le, 64)
+					if err != nil {
+						return nil, fmt.Errorf("malformed le %q", le)
+					}
+					key := leSeries{s.FullMethod(), seriesLabels(m)}
+					les[key] = append(les[key], grpcmetrics.BucketStats{
+						Upper: upper, Count: value(f, m),
+					})
+				}
+			case "handling_seconds":
+				// classic histograms are parsed as a whole family by expfmt
+				// when they are preceded by the TYPE line
+				if h := m.GetHistogram(); h != nil {
+					key := leSeries{get(m).FullMethod(), seriesLabels(m)}
+					for _, b := range h.Bucket {
+						les[key] = append(les[key], grpcmetrics.BucketStats{
+							Upper: b.GetUpperBound(), Count: b.GetCumulativeCount(),
+						})
+					}
+					les[key] = append(les[key], grpcmetrics.BucketStats{
+						Upper: math.Inf(1), Count: h.GetSampleCount(),
+					})
+				}
+			}
+		}
+	}
+
+	for key, buckets := range les {
+		s := stats[key.method]
+		s.Handling = s.Handling.Merge(cumulativeToHistogram(buckets))
+	}
+	list := make([]grpcmetrics.MethodStats, 0, len(stats))
+	for _, s := range stats {
+		if s.Handling != nil {
+			sort.Slice(s.Handling.Buckets, func(i, j int) bool {
+				return s.Handling.Buckets[i].Upper < s.Handling.Buckets[j].Upper
+			})
+		}
+		list = append(list, *s)
+	}
+	return list, nil
+}
+
+type leSeries struct {
+	method string
+	labels string // all labels but le
+}
+
+func seriesLabels(m *dto.Metric) string {
+	var list []string
+	for _, l := range m.Label {
+		if l.GetName() != "le" {
+			list = append(list, l.GetName()+"="+strconv.Quote(l.GetValue()))
+		}
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// cumulativeToHistogram converts le buckets with cumulative
+// counters into non-cumulative buckets with lower bounds.
+func cumulativeToHistogram(buckets []grpcmetrics.BucketStats) *grpcmetrics.HistogramStats {
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Upper < buckets[j].Upper
+	})
+	h := &grpcmetrics.HistogramStats{}
+	var lower float64
+	var seen uint64
+	for _, b := range buckets {
+		if b.Count > seen {
+			h.Buckets = append(h.Buckets, grpcmetrics.BucketStats{
+				Lower: lower, Upper: b.Upper, Count: b.Count - seen,
+			})
+			seen = b.Count
+		}
+		lower = b.Upper
+	}
+	h.Count = seen
+	return h
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func value(f *dto.MetricFamily, m *dto.Metric) uint64 {
+	var v float64
+	switch f.GetType() {
+	case dto.MetricType_COUNTER:
+		v = m.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		v = m.GetGauge().GetValue()
+	default:
+		v = m.GetUntyped().GetValue()
+	}
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	return uint64(v)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseExposition_le(t *testing.T) {
+	stats, err := parseExposition(strings.NewReader(`
+grpc_server_handled_total{grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 4
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",le="0.1"} 2
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",le="0.2"} 4
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",le="+Inf"} 4
+`), "grpc_server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("len(stats) = %d, want 1", len(stats))
+	}
+	s := stats[0]
+	if s.Handled[codes.OK] != 4 || s.Handling.Count != 4 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if p50 := s.Handling.Quantile(0.5); p50 != 0.1 {
+		t.Fatalf("p50 = %f, want 0.1", p50)
+	}
+}
+
+func TestParseExposition_leSeries(t *testing.T) {
+	stats, err := parseExposition(strings.NewReader(`
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",tenant="a",le="0.1"} 5
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",tenant="a",le="+Inf"} 10
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",tenant="b",le="0.1"} 3
+grpc_server_handling_seconds_bucket{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary",tenant="b",le="+Inf"} 4
+`), "grpc_server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := stats[0].Handling
+	if len(stats) != 1 || h.Count != 14 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(h.Buckets) != 2 || h.Buckets[0].Count != 8 || h.Buckets[1].Count != 6 {
+		t.Fatalf("unexpected buckets: %+v", h.Buckets)
+	}
+}
+
+func TestParseExposition_vmrange(t *testing.T) {
+	stats, err := parseExposition(strings.NewReader(`
+grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 2
+grpc_server_handling_seconds_bucket{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",vmrange="1.000e-01...2.000e-01"} 2
+grpc_server_handling_seconds_sum{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0.3
+grpc_server_handling_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 2
+`), "grpc_server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := stats[0]
+	if s.Started != 2 || s.Handling.Count != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if p50 := s.Handling.Quantile(0.5); math.Abs(p50-0.15) > 1e-9 {
+		t.Fatalf("p50 = %f, want 0.15", p50)
+	}
+}
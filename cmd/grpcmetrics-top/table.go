@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"google.golang.org/grpc/codes"
+)
+
+type row struct {
+	method   string
+	typ      string
+	rps      float64
+	errRatio float64
+	errors   map[codes.Code]float64
+	p50, p99 float64
+	inFlight uint64
+}
+
+// columns that rows can be sorted by, all but method are sorted in descending order.
+var columns = map[string]func(a, b *row) bool{
+	"method":   func(a, b *row) bool { return a.method < b.method },
+	"rps":      func(a, b *row) bool { return a.rps > b.rps },
+	"err":      func(a, b *row) bool { return a.errRatio > b.errRatio },
+	"p50":      func(a, b *row) bool { return greater(a.p50, b.p50) },
+	"p99":      func(a, b *row) bool { return greater(a.p99, b.p99) },
+	"inflight": func(a, b *row) bool { return a.inFlight > b.inFlight },
+}
+
+// greater orders NaNs last.
+func greater(a, b float64) bool {
+	if math.IsNaN(b) {
+		return !math.IsNaN(a)
+	}
+	return a > b
+}
+
+func buildRows(prev, cur []grpcmetrics.MethodStats, elapsed time.Duration) []row {
+	secs := elapsed.Seconds()
+	diff := grpcmetrics.DiffSnapshots(prev, cur) // ordered the same way as cur
+	rows := make([]row, 0, len(diff))
+	for i := range diff {
+		d := &diff[i]
+		r := row{
+			method:   d.FullMethod(),
+			typ:      d.Type,
+			errors:   map[codes.Code]float64{},
+			p50:      d.Handling.Quantile(0.5),
+			p99:      d.Handling.Quantile(0.99),
+			inFlight: cur[i].InFlight(),
+		}
+		if secs > 0 {
+			r.rps = float64(d.HandledTotal()) / secs
+			for code, n := range d.Handled {
+				if code != codes.OK && n != 0 {
+					r.errors[code] = float64(n) / secs
+				}
+			}
+		}
+		if n := d.HandledTotal(); n != 0 {
+			r.errRatio = float64(d.Errors()) / float64(n)
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func sortRows(rows []row, by string) error {
+	less, ok := columns[by]
+	if !ok {
+		return fmt.Errorf("unknown sort column %q", by)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if less(&rows[i], &rows[j]) {
+			return true
+		}
+		if less(&rows[j], &rows[i]) {
+			return false
+		}
+		return rows[i].method < rows[j].method
+	})
+	return nil
+}
+
+func render(w io.Writer, rows []row, limit int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tTYPE\tRPS\tERR%\tP50\tP99\tINFLIGHT\tERRORS/S")
+	for i := range rows {
+		if limit > 0 && i == limit {
+			break
+		}
+		r := &rows[i]
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%s\t%s\t%d\t%s\n",
+			r.method, r.typ, r.rps, r.errRatio*100,
+			formatSeconds(r.p50), formatSeconds(r.p99), r.inFlight,
+			formatErrors(r.errors),
+		)
+	}
+	return tw.Flush()
+}
+
+func formatSeconds(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return time.Duration(v * float64(time.Second)).Round(time.Microsecond).String()
+}
+
+func formatErrors(errs map[codes.Code]float64) string {
+	list := make([]codes.Code, 0, len(errs))
+	for code := range errs {
+		list = append(list, code)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if errs[list[i]] != errs[list[j]] {
+			return errs[list[i]] > errs[list[j]]
+		}
+		return list[i] < list[j]
+	})
+	var b strings.Builder
+	for i, code := range list {
+		if i != 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s:%.2f", code, errs[code])
+	}
+	return b.String()
+}
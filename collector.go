@@ -0,0 +1,180 @@
+package grpcmetrics
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector exposes series of m recorded into its backend, tenant sets
+// aside, to prometheus/client_golang registries, e.g. for promhttp.
+// Window gauges aren't included, they're available through WindowStats.
+// Histograms have le buckets of prometheus.DefBuckets bounds.
+func (m *ServerMetrics) Collector() prometheus.Collector {
+	return &collector{
+		counters: []string{
+			"grpc_server_started_total",
+			"grpc_server_msg_received_total",
+			"grpc_server_msg_sent_total",
+			"grpc_server_panics_total",
+			"grpc_server_shutdown_arrived_total",
+		},
+		handled: "grpc_server_handled_total",
+		histograms: []string{
+			"grpc_server_handling_seconds",
+			"grpc_server_shutdown_drain_seconds",
+			"grpc_server_queue_seconds",
+			"grpc_server_interceptor_seconds",
+			"grpc_server_post_handler_seconds",
+			"grpc_server_handling_middleware_seconds",
+			"grpc_server_handling_handler_seconds",
+		},
+		gauges: []string{
+			"grpc_server_shutdown_inflight_at_start",
+			"grpc_server_top_callers",
+		},
+		expired: "grpc_server_series_expired_total",
+		collect: func(c *collector, ch chan<- prometheus.Metric) {
+			handling, panics := m.exported()
+			for _, cnt := range []*counter{m.started, m.handled, m.msgRecv, m.msgSent, panics} {
+				c.counter(ch, m.s, cnt)
+			}
+			c.histogram(ch, m.s, handling)
+			c.expiredCounter(ch, m.expirer)
+			c.drain(ch, m.s, m.drain)
+			if m.phases != nil {
+				c.histogram(ch, m.s, m.phases.queue)
+				c.histogram(ch, m.s, m.phases.interceptor)
+				c.histogram(ch, m.s, m.phases.post)
+			}
+			if m.chain != nil {
+				c.histogram(ch, m.s, m.chain.middleware)
+				c.histogram(ch, m.s, m.chain.handler)
+			}
+			c.topCallers(ch, m.hitters)
+		},
+	}
+}
+
+// Collector is the client version of (*ServerMetrics).Collector.
+func (m *ClientMetrics) Collector() prometheus.Collector {
+	return &collector{
+		counters: []string{
+			"grpc_client_started_total",
+			"grpc_client_msg_received_total",
+			"grpc_client_msg_sent_total",
+		},
+		handled:    "grpc_client_handled_total",
+		histograms: []string{"grpc_client_handling_seconds"},
+		expired:    "grpc_client_series_expired_total",
+		collect: func(c *collector, ch chan<- prometheus.Metric) {
+			for _, cnt := range []*counter{m.started, m.handled, m.msgRecv, m.msgSent} {
+				c.counter(ch, m.s, cnt)
+			}
+			c.histogram(ch, m.s, m.exported())
+			c.expiredCounter(ch, m.expirer)
+		},
+	}
+}
+
+// collector describes all families that can be collected,
+// including the ones that are disabled but may be enabled by Update.
+//
+// Descriptors of collected series have the series' label names,
+// they differ from the described ones when the termination or custom
+// labels are used, that's fine because descriptor IDs only depend
+// on names and constant labels.
+type collector struct {
+	counters   []string
+	handled    string
+	histograms []string
+	gauges     []string
+	expired    string
+	collect    func(c *collector, ch chan<- prometheus.Metric)
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	for _, name := range c.counters {
+		ch <- prometheus.NewDesc(name, Help(name), labels, nil)
+	}
+	ch <- prometheus.NewDesc(c.handled, Help(c.handled), append(labels[:len(labels):len(labels)], "grpc_code"), nil)
+	for _, name := range c.histograms {
+		ch <- prometheus.NewDesc(name, Help(name), labels, nil)
+	}
+	for _, name := range c.gauges {
+		ch <- prometheus.NewDesc(name, Help(name), labels, nil)
+	}
+	ch <- prometheus.NewDesc(c.expired, Help(c.expired), nil, nil)
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(c, ch)
+}
+
+func (c *collector) counter(ch chan<- prometheus.Metric, b Backend, cnt *counter) {
+	if cnt == nil {
+		return
+	}
+	for _, sr := range cnt.seriesOf(b) {
+		desc, values := seriesDesc(cnt.name, sr.labels)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(sr.v.(Counter).Get()), values...)
+	}
+}
+
+// histogram converts non-cumulative buckets into cumulative ones.
+func (c *collector) histogram(ch chan<- prometheus.Metric, b Backend, h *histogram) {
+	if h == nil {
+		return
+	}
+	for _, sr := range h.seriesOf(b) {
+		desc, values := seriesDesc(h.name, sr.labels)
+		ch <- constHistogram(desc, sr.v.(Histogram).Stats(), values)
+	}
+}
+
+func constHistogram(desc *prometheus.Desc, stats *HistogramStats, values []string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(leBounds))
+	for i, n := range stats.cumulative() {
+		buckets[leBounds[i]] = n
+	}
+	return prometheus.MustNewConstHistogram(desc, stats.Count, stats.Sum, buckets, values...)
+}
+
+func (c *collector) drain(ch chan<- prometheus.Metric, b Backend, d *drain) {
+	if d == nil {
+		return
+	}
+	const inflight = "grpc_server_shutdown_inflight_at_start"
+	desc := prometheus.NewDesc(inflight, Help(inflight), []string{"grpc_type"}, nil)
+	for i, typ := range streamTypes {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(atomic.LoadInt64(&d.atStart[i])), typ)
+	}
+	const duration = "grpc_server_shutdown_drain_seconds"
+	ch <- constHistogram(prometheus.NewDesc(duration, Help(duration), nil, nil), d.duration.Stats(), nil)
+	c.counter(ch, b, d.arrived)
+}
+
+func (c *collector) expiredCounter(ch chan<- prometheus.Metric, e *expirer) {
+	if e == nil {
+		return
+	}
+	desc := prometheus.NewDesc(c.expired, Help(c.expired), nil, nil)
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(e.expired.Get()))
+}
+
+func (c *collector) topCallers(ch chan<- prometheus.Metric, h *hitters) {
+	h.each(func(key callerKey, cs CallerStats) {
+		desc, values := seriesDesc("grpc_server_top_callers", h.labels(key))
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(cs.Calls), values...)
+	})
+}
+
+func seriesDesc(name string, labels []Label) (*prometheus.Desc, []string) {
+	names := make([]string, len(labels))
+	values := make([]string, len(labels))
+	for i, l := range labels {
+		names[i], values[i] = l.Name, l.Value
+	}
+	return prometheus.NewDesc(name, Help(name), names, nil), values
+}
@@ -0,0 +1,112 @@
+package grpcmetrics
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerMetrics_Collector(t *testing.T) {
+	m := newServerMetrics(WithServerHandlingTimeHistogram(true))
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m.Collector())
+
+	call := func(err error) {
+		_, _ = UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+	call(nil)
+	call(status.Error(codes.NotFound, ""))
+	m.Update(WithServerTerminationLabel(true))
+	call(nil)
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_code="NotFound",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 1
+grpc_server_handled_total{grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 1
+grpc_server_handled_total{grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_termination="completed",grpc_type="unary"} 1
+# HELP grpc_server_started_total Total number of RPCs started on the server.
+# TYPE grpc_server_started_total counter
+grpc_server_started_total{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 3
+`), "grpc_server_handled_total", "grpc_server_started_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "grpc_server_handling_seconds" {
+			continue
+		}
+		h := mf.Metric[0].GetHistogram()
+		if h.GetSampleCount() != 3 || h.GetSampleSum() <= 0 {
+			t.Fatalf("unexpected histogram: %s", h)
+		}
+		return
+	}
+	t.Fatal("grpc_server_handling_seconds not found")
+}
+
+func TestClientMetrics_Collector(t *testing.T) {
+	m := newClientMetrics()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m.Collector())
+	if err := UnaryClientInterceptor(m)(context.Background(), "/grpc.health.v1.Health/Check", nil, nil, nil,
+		func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return nil
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := testutil.GatherAndCount(reg, "grpc_client_started_total", "grpc_client_handled_total"); err != nil || n != 2 {
+		t.Fatalf("GatherAndCount = %d, %v, want 2", n, err)
+	}
+}
+
+func TestServerMetrics_Collector_leBounds(t *testing.T) {
+	m := newServerMetrics(WithServerHandlingTimeHistogram(true))
+	m.handling.with(m.s, unary, "/grpc.health.v1.Health/Check").Update(0.003)
+	m.handling.with(m.s, unary, "/grpc.health.v1.Health/Watch").Update(0.3)
+	m.handling.with(m.s, unary, "/grpc.health.v1.Health/Watch").Update(42)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m.Collector())
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bounds [][]float64
+	for _, mf := range families {
+		if mf.GetName() != "grpc_server_handling_seconds" {
+			continue
+		}
+		for _, mc := range mf.Metric {
+			var list []float64
+			for _, b := range mc.GetHistogram().Bucket {
+				list = append(list, b.GetUpperBound())
+			}
+			bounds = append(bounds, list)
+		}
+	}
+	if len(bounds) != 2 {
+		t.Fatalf("got %d histogram series, want 2", len(bounds))
+	}
+	for _, list := range bounds {
+		if !reflect.DeepEqual(list, leBounds) {
+			t.Fatalf("le bounds = %v, want %v", list, leBounds)
+		}
+	}
+}
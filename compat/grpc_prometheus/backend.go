@@ -0,0 +1,88 @@
+package grpc_prometheus
+
+import (
+	"sync"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"github.com/amenzhinsky/grpcmetrics/clientgolang"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// backend records counters and gauges into one client_golang backend and
+// handling time histograms into another one created when histograms are
+// enabled, so that they have their own buckets and constant labels.
+type backend struct {
+	counters *clientgolang.Backend
+	c        prom.Collector // counters with constant labels
+
+	mu         sync.RWMutex
+	histograms *clientgolang.Backend
+	h          prom.Collector // histograms with constant labels
+}
+
+func newBackend(opts []CounterOption) *backend {
+	var o prom.CounterOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	b := clientgolang.New(nil)
+	return &backend{counters: b, c: withConstLabels(b, o.ConstLabels)}
+}
+
+// enableHistograms creates the histograms backend with the given options,
+// options of subsequent calls have no effect, like in go-grpc-prometheus.
+func (b *backend) enableHistograms(opts []HistogramOption) *clientgolang.Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.histograms != nil {
+		return b.histograms
+	}
+	o := prom.HistogramOpts{Buckets: prom.DefBuckets}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	b.histograms = clientgolang.New(o.Buckets)
+	b.h = withConstLabels(b.histograms, o.ConstLabels)
+	return b.histograms
+}
+
+func (b *backend) Counter(name string, labels []grpcmetrics.Label) grpcmetrics.Counter {
+	return b.counters.Counter(name, labels)
+}
+
+func (b *backend) Histogram(name string, labels []grpcmetrics.Label) grpcmetrics.Histogram {
+	b.mu.RLock()
+	h := b.histograms
+	b.mu.RUnlock()
+	if h == nil {
+		h = b.enableHistograms(nil)
+	}
+	return h.Histogram(name, labels)
+}
+
+func (b *backend) Gauge(name string, labels []grpcmetrics.Label, f func() float64) {
+	b.counters.Gauge(name, labels, f)
+}
+
+func (b *backend) Unregister(name string, labels []grpcmetrics.Label) {
+	b.counters.Unregister(name, labels)
+	b.mu.RLock()
+	h := b.histograms
+	b.mu.RUnlock()
+	if h != nil {
+		h.Unregister(name, labels)
+	}
+}
+
+// Describe sends nothing, so the collector is unchecked like clientgolang.Backend.
+func (b *backend) Describe(chan<- *prom.Desc) {}
+
+func (b *backend) Collect(ch chan<- prom.Metric) {
+	b.c.Collect(ch)
+	b.mu.RLock()
+	h := b.h
+	b.mu.RUnlock()
+	if h != nil {
+		h.Collect(ch)
+	}
+}
@@ -0,0 +1,63 @@
+package grpc_prometheus
+
+import (
+	"github.com/amenzhinsky/grpcmetrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+var (
+	DefaultClientMetrics = NewClientMetrics()
+
+	UnaryClientInterceptor = DefaultClientMetrics.UnaryClientInterceptor()
+
+	StreamClientInterceptor = DefaultClientMetrics.StreamClientInterceptor()
+)
+
+func init() {
+	prom.MustRegister(DefaultClientMetrics)
+}
+
+// EnableClientHandlingTimeHistogram enables handling time histogram for default
+// client metrics, calls started before it aren't observed.
+// Options of subsequent calls have no effect.
+func EnableClientHandlingTimeHistogram(opts ...HistogramOption) {
+	DefaultClientMetrics.EnableClientHandlingTimeHistogram(opts...)
+}
+
+// ClientMetrics is a prometheus.Collector.
+type ClientMetrics struct {
+	b *backend
+	m *grpcmetrics.ClientMetrics
+}
+
+func NewClientMetrics(counterOpts ...CounterOption) *ClientMetrics {
+	b := newBackend(counterOpts)
+	return &ClientMetrics{
+		b: b,
+		m: grpcmetrics.NewClientMetrics(grpcmetrics.WithClientBackend(b)),
+	}
+}
+
+func (m *ClientMetrics) EnableClientHandlingTimeHistogram(opts ...HistogramOption) {
+	m.b.enableHistograms(opts)
+	m.m.Update(grpcmetrics.WithClientHandlingTimeHistogram(true))
+}
+
+func (m *ClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return grpcmetrics.UnaryClientInterceptor(m.m)
+}
+
+func (m *ClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return grpcmetrics.StreamClientInterceptor(m.m)
+}
+
+// Describe implements prometheus.Collector.
+func (m *ClientMetrics) Describe(ch chan<- *prom.Desc) {
+	m.b.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *ClientMetrics) Collect(ch chan<- prom.Metric) {
+	m.b.Collect(ch)
+}
@@ -0,0 +1,61 @@
+package grpc_prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+)
+
+func TestClientMetrics(t *testing.T) {
+	m := NewClientMetrics(WithConstLabels(map[string]string{"env": "test"}))
+	m.EnableClientHandlingTimeHistogram(
+		WithHistogramBuckets([]float64{0.5, 5}),
+		WithHistogramConstLabels(map[string]string{"histogram": "yes"}),
+	)
+	if err := m.UnaryClientInterceptor()(
+		context.Background(), "/grpc.health.v1.Health/Check", nil, nil, nil,
+		func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return nil
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP grpc_client_started_total Total number of RPCs started on the client.
+# TYPE grpc_client_started_total counter
+grpc_client_started_total{env="test",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 1
+`), "grpc_client_started_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "grpc_client_handling_seconds" {
+			continue
+		}
+		mc := mf.Metric[0]
+		var labels []string
+		for _, l := range mc.Label {
+			labels = append(labels, l.GetName()+"="+l.GetValue())
+		}
+		if got := strings.Join(labels, ","); got != "grpc_method=Check,grpc_service=grpc.health.v1.Health,grpc_type=unary,histogram=yes" {
+			t.Fatalf("histogram labels = %s", got)
+		}
+		h := mc.GetHistogram()
+		if len(h.Bucket) != 2 || h.Bucket[0].GetUpperBound() != 0.5 || h.Bucket[1].GetUpperBound() != 5 || h.GetSampleCount() != 1 {
+			t.Fatalf("unexpected histogram: %s", h)
+		}
+		return
+	}
+	t.Fatal("grpc_client_handling_seconds not found")
+}
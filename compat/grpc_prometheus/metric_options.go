@@ -0,0 +1,59 @@
+package grpc_prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// CounterOption configures counters, only WithConstLabels is supported.
+type CounterOption func(*prom.CounterOpts)
+
+func WithConstLabels(labels prom.Labels) CounterOption {
+	return func(o *prom.CounterOpts) {
+		o.ConstLabels = labels
+	}
+}
+
+// HistogramOption configures the handling time histogram, buckets
+// are prometheus.DefBuckets by default.
+type HistogramOption func(*prom.HistogramOpts)
+
+func WithHistogramBuckets(buckets []float64) HistogramOption {
+	return func(o *prom.HistogramOpts) {
+		o.Buckets = buckets
+	}
+}
+
+func WithHistogramConstLabels(labels prom.Labels) HistogramOption {
+	return func(o *prom.HistogramOpts) {
+		o.ConstLabels = labels
+	}
+}
+
+// withConstLabels returns c with the given constant labels.
+func withConstLabels(c prom.Collector, labels prom.Labels) prom.Collector {
+	if len(labels) == 0 {
+		return c
+	}
+	var r collectorRegisterer
+	_ = prom.WrapRegistererWith(labels, &r).Register(c)
+	return r.c
+}
+
+// collectorRegisterer captures the registered collector, it's used
+// for obtaining collectors wrapped by prometheus.WrapRegistererWith.
+type collectorRegisterer struct {
+	c prom.Collector
+}
+
+func (r *collectorRegisterer) Register(c prom.Collector) error {
+	r.c = c
+	return nil
+}
+
+func (r *collectorRegisterer) MustRegister(cs ...prom.Collector) {
+	r.c = cs[0]
+}
+
+func (r *collectorRegisterer) Unregister(prom.Collector) bool {
+	return false
+}
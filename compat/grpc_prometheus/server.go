@@ -0,0 +1,80 @@
+// Package grpc_prometheus mirrors the go-grpc-prometheus API on top of grpcmetrics,
+// so migrating to it is a matter of replacing the import path:
+//
+//	grpc_prometheus "github.com/amenzhinsky/grpcmetrics/compat/grpc_prometheus"
+//
+// Series are recorded into client_golang metrics, see the clientgolang package,
+// and default metrics are registered with the default prometheus registry.
+package grpc_prometheus
+
+import (
+	"github.com/amenzhinsky/grpcmetrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+var (
+	DefaultServerMetrics = NewServerMetrics()
+
+	UnaryServerInterceptor = DefaultServerMetrics.UnaryServerInterceptor()
+
+	StreamServerInterceptor = DefaultServerMetrics.StreamServerInterceptor()
+)
+
+func init() {
+	prom.MustRegister(DefaultServerMetrics)
+}
+
+// Register pre-initializes default server metrics with methods registered
+// by the server, it should be called after all services are registered.
+func Register(server *grpc.Server) {
+	DefaultServerMetrics.InitializeMetrics(server)
+}
+
+// EnableHandlingTimeHistogram enables handling time histogram for default
+// server metrics, calls started before it aren't observed.
+// Options of subsequent calls have no effect.
+func EnableHandlingTimeHistogram(opts ...HistogramOption) {
+	DefaultServerMetrics.EnableHandlingTimeHistogram(opts...)
+}
+
+// ServerMetrics is a prometheus.Collector.
+type ServerMetrics struct {
+	b *backend
+	m *grpcmetrics.ServerMetrics
+}
+
+func NewServerMetrics(counterOpts ...CounterOption) *ServerMetrics {
+	b := newBackend(counterOpts)
+	return &ServerMetrics{
+		b: b,
+		m: grpcmetrics.NewServerMetrics(grpcmetrics.WithServerBackend(b)),
+	}
+}
+
+func (m *ServerMetrics) EnableHandlingTimeHistogram(opts ...HistogramOption) {
+	m.b.enableHistograms(opts)
+	m.m.Update(grpcmetrics.WithServerHandlingTimeHistogram(true))
+}
+
+func (m *ServerMetrics) InitializeMetrics(server *grpc.Server) {
+	m.m.InitializeMetrics(server)
+}
+
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return grpcmetrics.UnaryServerInterceptor(m.m)
+}
+
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return grpcmetrics.StreamServerInterceptor(m.m)
+}
+
+// Describe implements prometheus.Collector.
+func (m *ServerMetrics) Describe(ch chan<- *prom.Desc) {
+	m.b.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *ServerMetrics) Collect(ch chan<- prom.Metric) {
+	m.b.Collect(ch)
+}
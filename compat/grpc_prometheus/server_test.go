@@ -0,0 +1,76 @@
+package grpc_prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDefaultServerMetrics(t *testing.T) {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor),
+		grpc.StreamInterceptor(StreamServerInterceptor),
+	)
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	EnableHandlingTimeHistogram(WithHistogramBuckets([]float64{0.1, 1}))
+	EnableHandlingTimeHistogram()
+	Register(s)
+
+	if _, err := UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled, watch, handling bool
+	for _, mf := range families {
+		for _, mc := range mf.Metric {
+			switch {
+			case mf.GetName() == "grpc_server_handled_total" &&
+				label(mc, "grpc_method") == "Check" && label(mc, "grpc_code") == "OK":
+				handled = mc.GetCounter().GetValue() == 1
+			case mf.GetName() == "grpc_server_started_total" && label(mc, "grpc_method") == "Watch":
+				watch = mc.GetCounter().GetValue() == 0
+			case mf.GetName() == "grpc_server_handling_seconds" && label(mc, "grpc_method") == "Check":
+				// buckets of the first call are kept
+				h := mc.GetHistogram()
+				if len(h.Bucket) != 2 || h.Bucket[0].GetUpperBound() != 0.1 || h.Bucket[1].GetUpperBound() != 1 {
+					t.Fatalf("unexpected histogram: %s", h)
+				}
+				handling = h.GetSampleCount() == 1
+			}
+		}
+	}
+	if !handled || !watch || !handling {
+		t.Fatalf("default metrics aren't gathered: handled=%t, watch=%t, handling=%t", handled, watch, handling)
+	}
+
+	// default metrics aren't registered with the VictoriaMetrics default set
+	var b strings.Builder
+	metrics.WritePrometheus(&b, false)
+	if strings.Contains(b.String(), "grpc_server_") {
+		t.Fatalf("default metrics are in the VictoriaMetrics default set:\n%s", b.String())
+	}
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
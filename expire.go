@@ -0,0 +1,161 @@
+package grpcmetrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithServerSeriesTTL removes series that haven't been updated for longer
+// than ttl, apart from ones pre-populated by InitializeMetrics, and counts
+// them in grpc_server_series_expired_total. Window stats of methods without
+// calls for longer than ttl are removed along with their gauges.
+// Series are swept every ttl/2 but not more often than once a second.
+// Close stops the sweeper.
+func WithServerSeriesTTL(ttl time.Duration) ServerOption {
+	mustValidTTL(ttl)
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerSeriesTTL")
+		m.ttl = ttl
+	}
+}
+
+// WithClientSeriesTTL is the client version of WithServerSeriesTTL,
+// expired series are counted in grpc_client_series_expired_total.
+func WithClientSeriesTTL(ttl time.Duration) ClientOption {
+	mustValidTTL(ttl)
+	return func(m *ClientMetrics) {
+		m.mustNotUpdate("WithClientSeriesTTL")
+		m.ttl = ttl
+	}
+}
+
+func mustValidTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		panic(fmt.Sprintf("invalid series TTL: %s", ttl))
+	}
+}
+
+// Close stops the expired series sweeper and refreshing
+// of top callers and identities if they're running.
+func (m *ServerMetrics) Close() {
+	m.expirer.stop()
+	m.hitters.stop()
+	m.identity.stop()
+}
+
+// Close stops the expired series sweeper if it's running.
+func (m *ClientMetrics) Close() {
+	m.expirer.stop()
+}
+
+type expirer struct {
+	ttl     time.Duration
+	expired Counter
+	created time.Time
+	done    chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	metrics []*metric
+	windows *windows
+}
+
+// newExpirer starts sweeping series of the given metrics,
+// nil metrics of disabled options are skipped.
+func newExpirer(ttl time.Duration, s Backend, name string, list ...*metric) *expirer {
+	e := &expirer{
+		ttl:     ttl,
+		expired: s.Counter(name, nil),
+		created: time.Now(),
+		done:    make(chan struct{}),
+	}
+	for _, m := range list {
+		if m != nil {
+			m.track = true
+			e.metrics = append(e.metrics, m)
+		}
+	}
+	go e.run()
+	return e
+}
+
+func (e *expirer) run() {
+	t := time.NewTicker(sweepInterval(e.ttl))
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			e.sweep(now)
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// minSweepInterval keeps tiny TTLs from spinning the sweeper.
+const minSweepInterval = time.Second
+
+func sweepInterval(ttl time.Duration) time.Duration {
+	if d := ttl / 2; d > minSweepInterval {
+		return d
+	}
+	return minSweepInterval
+}
+
+// track starts sweeping series of a metric enabled by Update.
+func (e *expirer) track(m *metric) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m.mu.Lock()
+	m.track = true
+	m.mu.Unlock()
+	e.metrics = append(e.metrics, m)
+}
+
+// trackWindows starts sweeping window stats of idle methods.
+func (e *expirer) trackWindows(w *windows) {
+	if e == nil || w == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.windows = w
+}
+
+func (e *expirer) sweep(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, m := range e.metrics {
+		e.expired.Add(m.expire(now.Add(-e.ttl)))
+	}
+	if e.windows != nil {
+		e.expired.Add(e.windows.expire(now.Add(-e.ttl)))
+	}
+}
+
+func (e *expirer) stop() {
+	if e == nil {
+		return
+	}
+	e.once.Do(func() {
+		close(e.done)
+	})
+}
+
+func (c *counter) metricOrNil() *metric {
+	if c == nil {
+		return nil
+	}
+	return c.metric
+}
+
+func (h *histogram) metricOrNil() *metric {
+	if h == nil {
+		return nil
+	}
+	return h.metric
+}
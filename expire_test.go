@@ -0,0 +1,92 @@
+package grpcmetrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestWithServerSeriesTTL(t *testing.T) {
+	m := newServerMetrics(
+		WithServerHandlingTimeHistogram(true),
+		WithServerSeriesTTL(time.Hour),
+	)
+	defer m.Close()
+	m.InitializeMetrics(newServer())
+	if _, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/dynamic.Service/Method",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.expirer.sweep(time.Now())
+	checkContains(t, vmSet(m.s),
+		`grpc_server_started_total{grpc_type="unary",grpc_service="dynamic.Service",grpc_method="Method"} 1`,
+		`grpc_server_series_expired_total 0`,
+	)
+
+	m.expirer.sweep(time.Now().Add(2 * time.Hour))
+	var b bytes.Buffer
+	vmSet(m.s).WritePrometheus(&b)
+	if strings.Contains(b.String(), "dynamic.Service") {
+		t.Fatalf("idle series are not expired:\n%s", b.String())
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
+		`grpc_server_series_expired_total 5`,
+	)
+	for _, s := range m.Snapshot() {
+		if s.Service == "dynamic.Service" {
+			t.Fatal("expired series are in the snapshot")
+		}
+	}
+}
+
+func TestWithServerSeriesTTL_windows(t *testing.T) {
+	m := newServerMetrics(
+		WithServerWindowGauges(true),
+		WithServerSeriesTTL(time.Hour),
+	)
+	defer m.Close()
+	callUnary(context.Background(), m)
+
+	m.expirer.sweep(time.Now())
+	if _, ok := m.WindowStats("/grpc.health.v1.Health/Check", time.Minute); !ok {
+		t.Fatal("active window is expired")
+	}
+
+	m.expirer.sweep(time.Now().Add(2 * time.Hour))
+	if _, ok := m.WindowStats("/grpc.health.v1.Health/Check", time.Minute); ok {
+		t.Fatal("idle window isn't expired")
+	}
+	var b bytes.Buffer
+	vmSet(m.s).WritePrometheus(&b)
+	if strings.Contains(b.String(), "_1m{") {
+		t.Fatalf("gauges of the idle window aren't unregistered:\n%s", b.String())
+	}
+}
+
+func TestWithServerSeriesTTL_invalid(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("ttl %s: expected a panic", ttl)
+				}
+			}()
+			WithServerSeriesTTL(ttl)
+		}()
+	}
+	if d := sweepInterval(time.Nanosecond); d != minSweepInterval {
+		t.Errorf("sweep interval of tiny TTL = %s, want %s", d, minSweepInterval)
+	}
+	if d := sweepInterval(time.Hour); d != 30*time.Minute {
+		t.Errorf("sweep interval = %s, want 30m", d)
+	}
+}
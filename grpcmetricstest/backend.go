@@ -0,0 +1,177 @@
+package grpcmetricstest
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics"
+)
+
+// Backend keeps series in memory and histograms keep all observations,
+// so their stats are exact.
+//
+//	b := grpcmetricstest.NewBackend()
+//	m := grpcmetrics.NewServerMetrics(grpcmetrics.WithServerBackend(b))
+type Backend struct {
+	mu     sync.RWMutex
+	series map[string]*memSeries
+}
+
+type memSeries struct {
+	name   string
+	labels map[string]string
+	v      interface{} // *memCounter, *memHistogram or func() float64
+}
+
+func NewBackend() *Backend {
+	return &Backend{series: map[string]*memSeries{}}
+}
+
+func (b *Backend) Counter(name string, labels []grpcmetrics.Label) grpcmetrics.Counter {
+	return b.getOrCreate(name, labels, func() interface{} {
+		return &memCounter{}
+	}).(*memCounter)
+}
+
+func (b *Backend) Histogram(name string, labels []grpcmetrics.Label) grpcmetrics.Histogram {
+	return b.getOrCreate(name, labels, func() interface{} {
+		return &memHistogram{}
+	}).(*memHistogram)
+}
+
+func (b *Backend) Gauge(name string, labels []grpcmetrics.Label, f func() float64) {
+	b.getOrCreate(name, labels, func() interface{} {
+		return f
+	})
+}
+
+func (b *Backend) Unregister(name string, labels []grpcmetrics.Label) {
+	b.mu.Lock()
+	delete(b.series, key(name, labels))
+	b.mu.Unlock()
+}
+
+func (b *Backend) getOrCreate(name string, labels []grpcmetrics.Label, new func() interface{}) interface{} {
+	k := key(name, labels)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sr, ok := b.series[k]; ok {
+		return sr.v
+	}
+	sr := &memSeries{name: name, labels: make(map[string]string, len(labels)), v: new()}
+	for _, l := range labels {
+		sr.labels[l.Name] = l.Value
+	}
+	b.series[k] = sr
+	return sr.v
+}
+
+// Value is like the package-level Value, values of histograms are their
+// numbers of observations.
+func (b *Backend) Value(name, fullMethod string, labels ...string) (float64, bool) {
+	match, err := matcher(fullMethod, labels)
+	if err != nil {
+		panic(err)
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var sum float64
+	var found bool
+	for _, sr := range b.series {
+		if sr.name != name || !match(series{labels: sr.labels}) {
+			continue
+		}
+		switch v := sr.v.(type) {
+		case *memCounter:
+			sum += float64(v.Get())
+		case *memHistogram:
+			sum += float64(v.Stats().Count)
+		case func() float64:
+			sum += v()
+		}
+		found = true
+	}
+	return sum, found
+}
+
+// Observations returns values observed by histograms that match
+// the arguments the same way as in Value, in ascending order.
+func (b *Backend) Observations(name, fullMethod string, labels ...string) []float64 {
+	match, err := matcher(fullMethod, labels)
+	if err != nil {
+		panic(err)
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var list []float64
+	for _, sr := range b.series {
+		if h, ok := sr.v.(*memHistogram); ok && sr.name == name && match(series{labels: sr.labels}) {
+			h.mu.Lock()
+			list = append(list, h.values...)
+			h.mu.Unlock()
+		}
+	}
+	sort.Float64s(list)
+	return list
+}
+
+func key(name string, labels []grpcmetrics.Label) string {
+	k := name
+	for _, l := range labels {
+		k += "\xff" + l.Name + "\xff" + l.Value
+	}
+	return k
+}
+
+type memCounter struct {
+	n uint64
+}
+
+func (c *memCounter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+func (c *memCounter) Add(n int) {
+	atomic.AddUint64(&c.n, uint64(n))
+}
+
+func (c *memCounter) Get() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
+
+type memHistogram struct {
+	mu     sync.Mutex
+	values []float64
+}
+
+func (h *memHistogram) Update(v float64) {
+	h.mu.Lock()
+	h.values = append(h.values, v)
+	h.mu.Unlock()
+}
+
+func (h *memHistogram) UpdateDuration(startTime time.Time) {
+	h.Update(time.Since(startTime).Seconds())
+}
+
+// Stats returns a bucket per distinct observed value.
+func (h *memHistogram) Stats() *grpcmetrics.HistogramStats {
+	h.mu.Lock()
+	values := append([]float64(nil), h.values...)
+	h.mu.Unlock()
+	sort.Float64s(values)
+	s := &grpcmetrics.HistogramStats{Count: uint64(len(values))}
+	var lower float64
+	for i, v := range values {
+		s.Sum += v
+		if i != 0 && v == values[i-1] {
+			s.Buckets[len(s.Buckets)-1].Count++
+			continue
+		}
+		s.Buckets = append(s.Buckets, grpcmetrics.BucketStats{Lower: lower, Upper: v, Count: 1})
+		lower = v
+	}
+	return s
+}
@@ -0,0 +1,325 @@
+// Package grpcmetricstest provides helpers for testing code instrumented with grpcmetrics.
+//
+// Assertions read series from a metrics.Set, so they work the same way
+// no matter how the series have been recorded.
+package grpcmetricstest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/amenzhinsky/grpcmetrics"
+	"google.golang.org/grpc/codes"
+)
+
+var update = flag.Bool("grpcmetricstest.update", false, "update golden files")
+
+// NewServerMetrics creates server metrics on a fresh set, so tests don't interfere.
+func NewServerMetrics(opts ...grpcmetrics.ServerOption) (*grpcmetrics.ServerMetrics, *metrics.Set) {
+	s := metrics.NewSet()
+	return grpcmetrics.NewServerMetrics(append([]grpcmetrics.ServerOption{
+		grpcmetrics.WithServerMetricsSet(s),
+	}, opts...)...), s
+}
+
+// NewClientMetrics creates client metrics on a fresh set, so tests don't interfere.
+func NewClientMetrics(opts ...grpcmetrics.ClientOption) (*grpcmetrics.ClientMetrics, *metrics.Set) {
+	s := metrics.NewSet()
+	return grpcmetrics.NewClientMetrics(append([]grpcmetrics.ClientOption{
+		grpcmetrics.WithClientMetricsSet(s),
+	}, opts...)...), s
+}
+
+// Value returns the sum of values of the named series of the given method
+// that have all the given labels, passed as name-value pairs.
+// The second return value is false when there're no such series.
+func Value(s *metrics.Set, name, fullMethod string, labels ...string) (float64, bool) {
+	match, err := matcher(fullMethod, labels)
+	if err != nil {
+		panic(err)
+	}
+	var sum float64
+	var found bool
+	for _, sr := range parse(s) {
+		if sr.name == name && match(sr) {
+			sum += sr.value
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// AssertCounter checks the value of the named counter, see Value,
+// the counter must exist even when want is zero.
+func AssertCounter(t testing.TB, s *metrics.Set, name, fullMethod string, want float64, labels ...string) {
+	t.Helper()
+	assertValue(t, s, name, fullMethod, want, labels)
+}
+
+// AssertHandled checks the number of calls handled with the given code,
+// prefix is either grpc_server or grpc_client.
+func AssertHandled(t testing.TB, s *metrics.Set, prefix, fullMethod string, code codes.Code, want uint64) {
+	t.Helper()
+	assertValue(t, s, prefix+"_handled_total", fullMethod, float64(want), []string{
+		"grpc_code", code.String(),
+	})
+}
+
+// AssertHistogramCount checks the number of observations of the named histogram.
+func AssertHistogramCount(t testing.TB, s *metrics.Set, name, fullMethod string, want uint64, labels ...string) {
+	t.Helper()
+	assertValue(t, s, name+"_count", fullMethod, float64(want), labels)
+}
+
+func assertValue(t testing.TB, s *metrics.Set, name, fullMethod string, want float64, labels []string) {
+	t.Helper()
+	match, err := matcher(fullMethod, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got float64
+	var found bool
+	var candidates []string
+	for _, sr := range parse(s) {
+		if sr.name != name {
+			continue
+		}
+		candidates = append(candidates, sr.line)
+		if match(sr) {
+			got += sr.value
+			found = true
+		}
+	}
+	switch {
+	case !found:
+		t.Fatalf("%s%s not found, series with the same name:\n%s",
+			name, formatSelector(fullMethod, labels), formatCandidates(candidates))
+	case got != want:
+		t.Fatalf("%s%s = %s, want %s",
+			name, formatSelector(fullMethod, labels), formatValue(got), formatValue(want))
+	}
+}
+
+// AssertAbsent checks that there're no series of the named metric
+// of the given method that have all the given labels.
+func AssertAbsent(t testing.TB, s *metrics.Set, name, fullMethod string, labels ...string) {
+	t.Helper()
+	match, err := matcher(fullMethod, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, sr := range parse(s) {
+		if sr.name == name && match(sr) {
+			lines = append(lines, sr.line)
+		}
+	}
+	if len(lines) != 0 {
+		t.Fatalf("%s%s is present:\n%s",
+			name, formatSelector(fullMethod, labels), formatCandidates(lines))
+	}
+}
+
+// Exposition returns sorted series of the set in the prometheus text format,
+// histogram buckets and sums depend on timing so they're left out.
+func Exposition(s *metrics.Set) string {
+	var lines []string
+	for _, sr := range parse(s) {
+		if strings.HasSuffix(sr.name, "_bucket") || strings.HasSuffix(sr.name, "_sum") {
+			continue
+		}
+		lines = append(lines, sr.line)
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// AssertGolden compares Exposition of the set with the golden file,
+// run tests with -grpcmetricstest.update flag to update it.
+func AssertGolden(t testing.TB, s *metrics.Set, path string) {
+	t.Helper()
+	got := Exposition(s)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s, run with -grpcmetricstest.update to create it", err)
+	}
+	if diff := diffLines(string(b), got); diff != "" {
+		t.Fatalf("exposition differs from %s (-want +got):\n%s", path, diff)
+	}
+}
+
+func diffLines(want, got string) string {
+	wantSet := lineSet(want)
+	gotSet := lineSet(got)
+	var b strings.Builder
+	for _, l := range strings.Split(want, "\n") {
+		if l != "" && !gotSet[l] {
+			b.WriteString("- " + l + "\n")
+		}
+	}
+	for _, l := range strings.Split(got, "\n") {
+		if l != "" && !wantSet[l] {
+			b.WriteString("+ " + l + "\n")
+		}
+	}
+	return b.String()
+}
+
+func lineSet(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, l := range strings.Split(s, "\n") {
+		m[l] = true
+	}
+	return m
+}
+
+type series struct {
+	line   string
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+func parse(s *metrics.Set) []series {
+	var b bytes.Buffer
+	s.WritePrometheus(&b)
+	var list []series
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		sr, err := parseLine(line)
+		if err != nil {
+			panic(fmt.Sprintf("grpcmetricstest: %s: %q", err, line))
+		}
+		list = append(list, sr)
+	}
+	return list
+}
+
+func parseLine(line string) (series, error) {
+	sr := series{line: line, labels: map[string]string{}}
+	i := strings.LastIndexByte(line, ' ')
+	if i == -1 {
+		return sr, fmt.Errorf("no value")
+	}
+	v, err := strconv.ParseFloat(line[i+1:], 64)
+	if err != nil {
+		return sr, err
+	}
+	sr.value = v
+	rest := line[:i]
+
+	j := strings.IndexByte(rest, '{')
+	if j == -1 {
+		sr.name = rest
+		return sr, nil
+	}
+	sr.name = rest[:j]
+	rest = rest[j+1:]
+	for {
+		if strings.HasPrefix(rest, "}") {
+			return sr, nil
+		}
+		eq := strings.Index(rest, `="`)
+		if eq == -1 {
+			return sr, fmt.Errorf("malformed labels")
+		}
+		name := rest[:eq]
+		value, n, err := unquote(rest[eq+1:])
+		if err != nil {
+			return sr, err
+		}
+		sr.labels[name] = value
+		rest = strings.TrimPrefix(rest[eq+1+n:], ",")
+	}
+}
+
+// unquote unquotes a prefix of s and returns the number of bytes consumed.
+func unquote(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated label value")
+}
+
+func matcher(fullMethod string, labels []string) (func(sr series) bool, error) {
+	if len(labels)%2 != 0 {
+		return nil, fmt.Errorf("odd number of label name-value pairs: %q", labels)
+	}
+	var service, method string
+	if fullMethod != "" {
+		i := strings.IndexByte(fullMethod[1:], '/')
+		if i == -1 || fullMethod[0] != '/' {
+			return nil, fmt.Errorf("malformed full method: %q", fullMethod)
+		}
+		service, method = fullMethod[1:i+1], fullMethod[i+2:]
+	}
+	return func(sr series) bool {
+		if fullMethod != "" && (sr.labels["grpc_service"] != service || sr.labels["grpc_method"] != method) {
+			return false
+		}
+		for i := 0; i < len(labels); i += 2 {
+			if sr.labels[labels[i]] != labels[i+1] {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func formatSelector(fullMethod string, labels []string) string {
+	var pairs []string
+	if fullMethod != "" {
+		pairs = append(pairs, "method="+strconv.Quote(fullMethod))
+	}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatCandidates(lines []string) string {
+	if len(lines) == 0 {
+		return "  (none)"
+	}
+	sort.Strings(lines)
+	return "  " + strings.Join(lines, "\n  ")
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,116 @@
+package grpcmetricstest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAssertions(t *testing.T) {
+	m, s := NewServerMetrics(grpcmetrics.WithServerHandlingTimeHistogram(true))
+	for _, err := range []error{nil, nil, status.Error(codes.NotFound, "")} {
+		_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+
+	AssertCounter(t, s, "grpc_server_started_total", "/grpc.health.v1.Health/Check", 3)
+	AssertCounter(t, s, "grpc_server_handled_total", "/grpc.health.v1.Health/Check", 3)
+	AssertAbsent(t, s, "grpc_server_handled_total", "/grpc.health.v1.Health/Check", "grpc_code", "Internal")
+	AssertAbsent(t, s, "grpc_server_handled_total", "/grpc.health.v1.Health/Watch")
+	AssertHandled(t, s, "grpc_server", "/grpc.health.v1.Health/Check", codes.NotFound, 1)
+	AssertHistogramCount(t, s, "grpc_server_handling_seconds", "/grpc.health.v1.Health/Check", 3)
+	AssertGolden(t, s, "testdata/server.golden")
+
+	if v, ok := Value(s, "grpc_server_handled_total", "", "grpc_code", "OK"); !ok || v != 2 {
+		t.Fatalf("Value = %f, %t, want 2, true", v, ok)
+	}
+}
+
+func TestAssertCounter_failure(t *testing.T) {
+	_, s := NewClientMetrics()
+	ft := &fakeT{}
+	AssertCounter(ft, s, "grpc_client_started_total", "/grpc.health.v1.Health/Check", 1)
+	if want := `grpc_client_started_total{method="/grpc.health.v1.Health/Check"} not found, series with the same name:
+  (none)`; ft.msg != want {
+		t.Fatalf("message = %q, want %q", ft.msg, want)
+	}
+}
+
+func TestAssertCounter_missingZero(t *testing.T) {
+	_, s := NewClientMetrics()
+	ft := &fakeT{}
+	AssertCounter(ft, s, "grpc_client_started_total", "/grpc.health.v1.Health/Check", 0)
+	if ft.msg == "" {
+		t.Fatal("missing series are accepted as zero")
+	}
+}
+
+func TestAssertAbsent_failure(t *testing.T) {
+	m, s := NewServerMetrics()
+	_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	ft := &fakeT{}
+	AssertAbsent(ft, s, "grpc_server_started_total", "/grpc.health.v1.Health/Check")
+	if want := `grpc_server_started_total{method="/grpc.health.v1.Health/Check"} is present:
+  grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`; ft.msg != want {
+		t.Fatalf("message = %q, want %q", ft.msg, want)
+	}
+}
+
+type fakeT struct {
+	testing.TB
+	msg string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Fatal(args ...interface{}) {
+	t.msg = args[0].(string)
+}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.msg = fmt.Sprintf(format, args...)
+}
+
+func TestBackend(t *testing.T) {
+	b := NewBackend()
+	m := grpcmetrics.NewServerMetrics(
+		grpcmetrics.WithServerBackend(b),
+		grpcmetrics.WithServerHandlingTimeHistogram(true),
+	)
+	for _, err := range []error{nil, status.Error(codes.NotFound, "")} {
+		_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+
+	for _, c := range []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"grpc_server_started_total", nil, 2},
+		{"grpc_server_handled_total", []string{"grpc_code", "NotFound"}, 1},
+		{"grpc_server_handling_seconds", nil, 2},
+	} {
+		if v, ok := b.Value(c.name, "/grpc.health.v1.Health/Check", c.labels...); !ok || v != c.want {
+			t.Errorf("Value(%s) = %f, %t, want %f, true", c.name, v, ok, c.want)
+		}
+	}
+	if got := b.Observations("grpc_server_handling_seconds", ""); len(got) != 2 {
+		t.Errorf("Observations = %v, want 2 values", got)
+	}
+}
@@ -0,0 +1,332 @@
+package grpcmetrics
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// WithServerTopCallers tracks the k busiest callers of every method identified
+// by fn, e.g. PeerIdentity, PeerAddress or MetadataIdentity, without a series
+// per caller. Callers are counted with the space-saving algorithm in a fixed
+// space of 4*k per method, counts are reset every refresh interval and
+// methods without calls during an interval are forgotten.
+//
+// The top of the last interval is available in Snapshot and TopCallers,
+// and as grpc_server_top_callers gauges labeled with grpc_caller.
+// Close stops refreshing.
+func WithServerTopCallers(fn IdentityFunc, k int, refresh time.Duration) ServerOption {
+	if k <= 0 {
+		panic(fmt.Sprintf("invalid number of top callers: %d", k))
+	}
+	if refresh <= 0 {
+		panic(fmt.Sprintf("invalid top callers refresh interval: %s", refresh))
+	}
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerTopCallers")
+		if fn == nil {
+			fn = PeerIdentity
+		}
+		m.hitters = &hitters{
+			fn:       fn,
+			k:        k,
+			interval: refresh,
+			methods:  map[string]*sketch{},
+			top:      map[string][]CallerStats{},
+			gauges:   map[callerKey]struct{}{},
+			done:     make(chan struct{}),
+		}
+	}
+}
+
+// PeerAddress identifies callers by their network addresses.
+func PeerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// MetadataIdentity identifies callers by the first value of the incoming metadata key.
+func MetadataIdentity(key string) IdentityFunc {
+	return func(ctx context.Context) string {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if v := md.Get(key); len(v) != 0 {
+			return v[0]
+		}
+		return ""
+	}
+}
+
+// CallerStats is an estimated number of calls of a caller, the actual
+// number is between Calls-Error and Calls.
+type CallerStats struct {
+	Caller string
+	Calls  uint64
+	Error  uint64
+}
+
+// TopCallers returns the busiest callers of the method during the last
+// refresh interval, it's nil when top callers aren't tracked.
+func (m *ServerMetrics) TopCallers(fullMethod string) []CallerStats {
+	return m.hitters.get(fullMethod)
+}
+
+type hitters struct {
+	fn       IdentityFunc
+	k        int
+	interval time.Duration
+	s        Backend
+
+	mu      sync.RWMutex
+	methods map[string]*sketch
+
+	topMu  sync.RWMutex
+	top    map[string][]CallerStats
+	types  map[string]string
+	gauges map[callerKey]struct{} // registered gauges, accessed by refresh only
+
+	done chan struct{}
+	once sync.Once
+}
+
+type callerKey struct {
+	typ, method, caller string
+}
+
+func (h *hitters) start(s Backend) {
+	h.s = s
+	go func() {
+		t := time.NewTicker(h.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				h.refresh()
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+func (h *hitters) stop() {
+	if h == nil {
+		return
+	}
+	h.once.Do(func() {
+		close(h.done)
+	})
+}
+
+func (h *hitters) observe(ctx context.Context, typ, method string) {
+	h.mu.RLock()
+	sk, ok := h.methods[method]
+	h.mu.RUnlock()
+	if !ok {
+		h.mu.Lock()
+		if sk, ok = h.methods[method]; !ok {
+			sk = &sketch{typ: typ, capacity: 4 * h.k, idx: map[string]*entry{}}
+			h.methods[method] = sk
+		}
+		h.mu.Unlock()
+	}
+	caller := h.fn(ctx)
+	if caller == "" {
+		caller = unknownIdentity
+	}
+	sk.add(caller)
+}
+
+func (h *hitters) get(method string) []CallerStats {
+	if h == nil {
+		return nil
+	}
+	h.topMu.RLock()
+	defer h.topMu.RUnlock()
+	return h.top[method]
+}
+
+// refresh publishes the top of every method and resets counts,
+// gauges of callers that dropped out of the top are unregistered
+// and sketches of idle methods are removed.
+func (h *hitters) refresh() {
+	h.mu.RLock()
+	top := make(map[string][]CallerStats, len(h.methods))
+	types := make(map[string]string, len(h.methods))
+	var idle []string
+	for method, sk := range h.methods {
+		if list := sk.reset(h.k); len(list) != 0 {
+			top[method] = list
+			types[method] = sk.typ
+		} else {
+			idle = append(idle, method)
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(idle) != 0 {
+		h.mu.Lock()
+		for _, method := range idle {
+			// calls may have arrived since the reset
+			if sk, ok := h.methods[method]; ok && sk.empty() {
+				delete(h.methods, method)
+			}
+		}
+		h.mu.Unlock()
+	}
+
+	h.topMu.Lock()
+	h.top, h.types = top, types
+	h.topMu.Unlock()
+
+	current := map[callerKey]struct{}{}
+	for method, list := range top {
+		for _, c := range list {
+			key := callerKey{types[method], method, c.Caller}
+			current[key] = struct{}{}
+			if _, ok := h.gauges[key]; !ok {
+				h.s.Gauge("grpc_server_top_callers", h.labels(key), h.value(method, c.Caller))
+			}
+		}
+	}
+	for key := range h.gauges {
+		if _, ok := current[key]; !ok {
+			h.s.Unregister("grpc_server_top_callers", h.labels(key))
+		}
+	}
+	h.gauges = current
+}
+
+// each calls fn for every caller of the last interval ordered by method.
+func (h *hitters) each(fn func(key callerKey, c CallerStats)) {
+	if h == nil {
+		return
+	}
+	h.topMu.RLock()
+	defer h.topMu.RUnlock()
+	methods := make([]string, 0, len(h.top))
+	for method := range h.top {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		for _, c := range h.top[method] {
+			fn(callerKey{h.types[method], method, c.Caller}, c)
+		}
+	}
+}
+
+func (h *hitters) labels(key callerKey) []Label {
+	return methodLabels(key.typ, key.method, noCode, renderLabels([]string{"grpc_caller"}, []string{key.caller}))
+}
+
+func (h *hitters) value(method, caller string) func() float64 {
+	return func() float64 {
+		for _, c := range h.get(method) {
+			if c.Caller == caller {
+				return float64(c.Calls)
+			}
+		}
+		return 0
+	}
+}
+
+// sketch is a space-saving summary, entries are kept in a min-heap,
+// so the least counted one is replaced when it's full.
+type sketch struct {
+	typ      string
+	capacity int
+
+	mu      sync.Mutex
+	idx     map[string]*entry
+	entries entryHeap
+}
+
+type entry struct {
+	caller string
+	count  uint64
+	err    uint64
+	i      int
+}
+
+func (sk *sketch) add(caller string) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	if e, ok := sk.idx[caller]; ok {
+		e.count++
+		heap.Fix(&sk.entries, e.i)
+		return
+	}
+	if len(sk.entries) < sk.capacity {
+		e := &entry{caller: caller, count: 1}
+		sk.idx[caller] = e
+		heap.Push(&sk.entries, e)
+		return
+	}
+	e := sk.entries[0]
+	delete(sk.idx, e.caller)
+	e.caller, e.err = caller, e.count
+	e.count++
+	sk.idx[caller] = e
+	heap.Fix(&sk.entries, 0)
+}
+
+// reset returns the top k callers and forgets all of them.
+func (sk *sketch) reset(k int) []CallerStats {
+	sk.mu.Lock()
+	list := make([]CallerStats, 0, len(sk.entries))
+	for _, e := range sk.entries {
+		list = append(list, CallerStats{Caller: e.caller, Calls: e.count, Error: e.err})
+	}
+	sk.idx = map[string]*entry{}
+	sk.entries = sk.entries[:0]
+	sk.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Calls != list[j].Calls {
+			return list[i].Calls > list[j].Calls
+		}
+		return list[i].Caller < list[j].Caller
+	})
+	if len(list) > k {
+		list = list[:k]
+	}
+	return list
+}
+
+func (sk *sketch) empty() bool {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	return len(sk.entries) == 0
+}
+
+type entryHeap []*entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].i = i
+	h[j].i = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.i = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,97 @@
+package grpcmetrics
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSketch(t *testing.T) {
+	sk := &sketch{capacity: 8, idx: map[string]*entry{}}
+	for i := 0; i < 1000; i++ {
+		sk.add("noisy")
+		if i%2 == 0 {
+			sk.add("busy")
+		}
+		sk.add("caller-" + strconv.Itoa(i)) // every other caller is seen once
+	}
+	top := sk.reset(2)
+	if len(top) != 2 || top[0].Caller != "noisy" || top[1].Caller != "busy" {
+		t.Fatalf("top = %+v", top)
+	}
+	for i, want := range []uint64{1000, 500} {
+		if c := top[i]; c.Calls < want || c.Calls-c.Error > want {
+			t.Fatalf("estimate %+v doesn't bound %d", c, want)
+		}
+	}
+	if len(sk.idx) != 0 || len(sk.entries) != 0 {
+		t.Fatal("sketch isn't reset")
+	}
+}
+
+func TestWithServerTopCallers(t *testing.T) {
+	m := newServerMetrics(WithServerTopCallers(MetadataIdentity("x-caller"), 1, time.Hour))
+	defer m.Close()
+	call := func(caller string, n int) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-caller", caller))
+		for i := 0; i < n; i++ {
+			callUnary(ctx, m)
+		}
+	}
+	call("billing", 3)
+	call("search", 1)
+	m.hitters.refresh()
+
+	if top := m.TopCallers("/grpc.health.v1.Health/Check"); len(top) != 1 || top[0] != (CallerStats{"billing", 3, 0}) {
+		t.Fatalf("TopCallers = %+v", top)
+	}
+	if s := m.Snapshot(); len(s) != 1 || len(s[0].TopCallers) != 1 {
+		t.Fatalf("Snapshot = %+v", s)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_top_callers{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_caller="billing"} 3`,
+	)
+
+	// callers that drop out of the top lose their gauges
+	call("search", 2)
+	m.hitters.refresh()
+	checkContains(t, vmSet(m.s),
+		`grpc_server_top_callers{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_caller="search"} 2`,
+	)
+	var b bytes.Buffer
+	vmSet(m.s).WritePrometheus(&b)
+	if strings.Contains(b.String(), `grpc_caller="billing"`) {
+		t.Fatalf("billing gauge isn't unregistered:\n%s", b.String())
+	}
+	checkExposed(t, m, "grpc_server_top_callers")
+
+	// sketches of idle methods are removed
+	m.hitters.refresh()
+	if n := len(m.hitters.methods); n != 0 {
+		t.Fatalf("%d sketches of idle methods are kept", n)
+	}
+}
+
+func TestWithServerTopCallers_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		k       int
+		refresh time.Duration
+	}{
+		{0, time.Second},
+		{1, 0},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithServerTopCallers(%d, %s) doesn't panic", tc.k, tc.refresh)
+				}
+			}()
+			WithServerTopCallers(nil, tc.k, tc.refresh)
+		}()
+	}
+}
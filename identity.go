@@ -0,0 +1,188 @@
+package grpcmetrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	unknownIdentity = "unknown"
+	otherIdentity   = "other"
+)
+
+// IdentityFunc returns the identity of the calling service, empty when it's unknown.
+type IdentityFunc func(ctx context.Context) string
+
+// PeerIdentity returns the SPIFFE ID of the peer's TLS certificate, or its
+// common name when there's none, it's empty for calls without mutual TLS.
+func PeerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := info.State.PeerCertificates[0]
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			return u.String()
+		}
+	}
+	return cert.Subject.CommonName
+}
+
+// WithServerClientIdentity adds grpc_client_identity label to grpc_server_handled_total,
+// identities are returned by fn, PeerIdentity when it's nil. Identities that aren't
+// in allow are accounted as "other", and calls without one as "unknown".
+func WithServerClientIdentity(fn IdentityFunc, allow ...string) ServerOption {
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerClientIdentity")
+		m.identity = newIdentities(fn)
+		for _, id := range allow {
+			m.identity.labels[id] = renderIdentity(id)
+		}
+	}
+}
+
+// WithServerClientIdentityTop is like WithServerClientIdentity but instead of
+// an allow-list the n busiest identities of the last refresh interval get their
+// own label values, they're counted the same way as WithServerTopCallers.
+// Calls of other identities, and of all of them before the first refresh,
+// are accounted as "other". Close stops refreshing.
+func WithServerClientIdentityTop(fn IdentityFunc, n int, refresh time.Duration) ServerOption {
+	if n <= 0 {
+		panic(fmt.Sprintf("invalid number of top identities: %d", n))
+	}
+	if refresh <= 0 {
+		panic(fmt.Sprintf("invalid top identities refresh interval: %s", refresh))
+	}
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerClientIdentityTop")
+		m.identity = newIdentities(fn)
+		m.identity.top = n
+		m.identity.interval = refresh
+		m.identity.sk = &sketch{capacity: 4 * n, idx: map[string]*entry{}}
+	}
+}
+
+// identities caches rendered labels, so calls of known callers don't allocate.
+type identities struct {
+	fn IdentityFunc
+
+	// top identities are counted in sk, nil for allow-lists
+	top      int
+	interval time.Duration
+	sk       *sketch
+	done     chan struct{}
+	once     sync.Once
+
+	mu     sync.RWMutex
+	labels map[string]string
+}
+
+func newIdentities(fn IdentityFunc) *identities {
+	if fn == nil {
+		fn = PeerIdentity
+	}
+	return &identities{
+		fn:     fn,
+		done:   make(chan struct{}),
+		labels: baseIdentities(),
+	}
+}
+
+func baseIdentities() map[string]string {
+	return map[string]string{
+		"":            renderIdentity(unknownIdentity),
+		otherIdentity: renderIdentity(otherIdentity),
+	}
+}
+
+func (ids *identities) start() {
+	if ids == nil || ids.sk == nil {
+		return
+	}
+	go func() {
+		t := time.NewTicker(ids.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				ids.refresh()
+			case <-ids.done:
+				return
+			}
+		}
+	}()
+}
+
+func (ids *identities) stop() {
+	if ids == nil {
+		return
+	}
+	ids.once.Do(func() {
+		close(ids.done)
+	})
+}
+
+// refresh replaces labeled identities with the top of the last interval.
+func (ids *identities) refresh() {
+	list := ids.sk.reset(ids.top)
+	ids.mu.RLock()
+	labels := baseIdentities()
+	for _, c := range list {
+		if l, ok := ids.labels[c.Caller]; ok {
+			labels[c.Caller] = l
+		} else {
+			labels[c.Caller] = renderIdentity(c.Caller)
+		}
+	}
+	ids.mu.RUnlock()
+
+	ids.mu.Lock()
+	ids.labels = labels
+	ids.mu.Unlock()
+}
+
+// render returns the rendered label of the caller.
+func (ids *identities) render(ctx context.Context) string {
+	if ids == nil {
+		return ""
+	}
+	id := ids.fn(ctx)
+	if ids.sk != nil && id != "" {
+		ids.sk.add(id)
+	}
+	ids.mu.RLock()
+	defer ids.mu.RUnlock()
+	if l, ok := ids.labels[id]; ok {
+		return l
+	}
+	return ids.labels[otherIdentity]
+}
+
+// renderFallback is used for pre-populated series.
+func (ids *identities) renderFallback() string {
+	if ids == nil {
+		return ""
+	}
+	ids.mu.RLock()
+	defer ids.mu.RUnlock()
+	return ids.labels[""]
+}
+
+func renderIdentity(id string) string {
+	var b strings.Builder
+	b.WriteString(`grpc_client_identity="`)
+	writeLabelValue(&b, id)
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package grpcmetrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func TestPeerIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/ns/default/sa/billing")
+	for _, c := range []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"no peer", context.Background(), ""},
+		{"insecure", peer.NewContext(context.Background(), &peer.Peer{}), ""},
+		{"spiffe", tlsPeer(&x509.Certificate{
+			URIs:    []*url.URL{spiffe},
+			Subject: pkix.Name{CommonName: "billing"},
+		}), "spiffe://example.org/ns/default/sa/billing"},
+		{"cn", tlsPeer(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "billing"},
+		}), "billing"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if got := PeerIdentity(c.ctx); got != c.want {
+				t.Fatalf("PeerIdentity = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func tlsPeer(cert *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+		}},
+	})
+}
+
+func TestWithServerClientIdentity(t *testing.T) {
+	m := newServerMetrics(WithServerClientIdentity(nil, "billing"))
+	for _, cn := range []string{"billing", "billing", "search", ""} {
+		ctx := context.Background()
+		if cn != "" {
+			ctx = tlsPeer(&x509.Certificate{Subject: pkix.Name{CommonName: cn}})
+		}
+		callUnary(ctx, m)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK",grpc_client_identity="billing"} 2`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK",grpc_client_identity="other"} 1`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK",grpc_client_identity="unknown"} 1`,
+	)
+}
+
+func TestWithServerClientIdentityTop(t *testing.T) {
+	m := newServerMetrics(WithServerClientIdentityTop(func(ctx context.Context) string {
+		return ctx.Value(identityKey{}).(string)
+	}, 2, time.Hour), WithServerTerminationLabel(true))
+	defer m.Close()
+	call := func(ids ...string) {
+		for _, id := range ids {
+			callUnary(context.WithValue(context.Background(), identityKey{}, id), m)
+		}
+	}
+	// identities are labeled by the top of the previous interval
+	call("a", "b", "c", "c", "d", "d", "d")
+	m.identity.refresh()
+	call("a", "c", "c", "d", "d")
+	m.identity.refresh()
+	call("a", "d")
+	checkContains(t, vmSet(m.s),
+		`grpc_code="OK",grpc_termination="completed",grpc_client_identity="other"} 9`,
+		`grpc_code="OK",grpc_termination="completed",grpc_client_identity="c"} 2`,
+		`grpc_code="OK",grpc_termination="completed",grpc_client_identity="d"} 3`,
+	)
+}
+
+func TestWithServerClientIdentityTop_invalid(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithServerClientIdentityTop(%d) doesn't panic", n)
+				}
+			}()
+			WithServerClientIdentityTop(nil, n, time.Minute)
+		}()
+	}
+}
+
+type identityKey struct{}
+
+func callUnary(ctx context.Context, m *ServerMetrics) {
+	_, _ = UnaryServerInterceptor(m)(ctx, nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+}
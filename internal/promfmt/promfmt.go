@@ -0,0 +1,37 @@
+// Package promfmt contains helpers for prometheus formats shared by grpcmetrics packages.
+package promfmt
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseVMRange parses "<start>...<end>" bounds of VictoriaMetrics histogram buckets.
+func ParseVMRange(s string) (float64, float64, bool) {
+	i := strings.Index(s, "...")
+	if i == -1 {
+		return 0, 0, false
+	}
+	lower, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	upper, err := strconv.ParseFloat(s[i+3:], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lower, upper, true
+}
+
+// Duration formats d as a prometheus duration, e.g. "5m".
+func Duration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+}
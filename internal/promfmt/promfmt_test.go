@@ -0,0 +1,30 @@
+package promfmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseVMRange(t *testing.T) {
+	if lower, upper, ok := ParseVMRange("1.000e-03...1.136e-03"); !ok || lower != 0.001 || upper != 0.001136 {
+		t.Fatalf("ParseVMRange = %v, %v, %v", lower, upper, ok)
+	}
+	for _, s := range []string{"", "1.0", "a...1", "1...b"} {
+		if _, _, ok := ParseVMRange(s); ok {
+			t.Errorf("ParseVMRange(%q) is ok", s)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		10 * time.Second: "10s",
+		90 * time.Second: "90s",
+		5 * time.Minute:  "5m",
+		2 * time.Hour:    "2h",
+	} {
+		if got := Duration(d); got != want {
+			t.Errorf("Duration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
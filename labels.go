@@ -0,0 +1,129 @@
+package grpcmetrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// WithServerLabel declares a custom label with the given fallback value that is attached
+// to grpc_server_handled_total and grpc_server_handling_seconds series,
+// its value is set by handlers with SetLabel during a call.
+func WithServerLabel(name, fallback string) ServerOption {
+	if !isLabelName(name) || strings.HasPrefix(name, "grpc_") {
+		panic(fmt.Sprintf("invalid custom label name: %q", name))
+	}
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerLabel")
+		if m.labels == nil {
+			m.labels = &customLabels{}
+		}
+		for _, n := range m.labels.names {
+			if n == name {
+				panic(fmt.Sprintf("custom label %q is already declared", name))
+			}
+		}
+		m.labels.names = append(m.labels.names, name)
+		m.labels.fallbacks = append(m.labels.fallbacks, fallback)
+	}
+}
+
+// SetLabel sets the named custom label value of the current call, it reports
+// whether the label is declared with WithServerLabel and ctx belongs to a call.
+func SetLabel(ctx context.Context, name, value string) bool {
+	v, ok := ctx.Value(callLabelsKey{}).(*callLabels)
+	if !ok {
+		return false
+	}
+	for i, n := range v.labels.names {
+		if n == name {
+			v.mu.Lock()
+			v.values[i] = value
+			v.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+type customLabels struct {
+	names     []string
+	fallbacks []string
+}
+
+type callLabelsKey struct{}
+
+type callLabels struct {
+	mu     sync.Mutex
+	labels *customLabels
+	values []string
+}
+
+func (l *customLabels) newContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callLabelsKey{}, &callLabels{
+		labels: l,
+		values: append([]string(nil), l.fallbacks...),
+	})
+}
+
+// render returns labels of the call that ctx belongs to,
+// or fallback values when it doesn't belong to any.
+func (l *customLabels) render(ctx context.Context) string {
+	if l == nil {
+		return ""
+	}
+	v, ok := ctx.Value(callLabelsKey{}).(*callLabels)
+	if !ok {
+		return renderLabels(l.names, l.fallbacks)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return renderLabels(l.names, v.values)
+}
+
+func (l *customLabels) renderFallbacks() string {
+	if l == nil {
+		return ""
+	}
+	return renderLabels(l.names, l.fallbacks)
+}
+
+func renderLabels(names, values []string) string {
+	var b strings.Builder
+	for i := range names {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(names[i])
+		b.WriteString(`="`)
+		writeLabelValue(&b, values[i])
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func isLabelName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func joinLabels(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "," + b
+	}
+}
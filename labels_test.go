@@ -0,0 +1,61 @@
+package grpcmetrics
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestSetLabel(t *testing.T) {
+	m := newServerMetrics(
+		WithServerHandlingTimeHistogram(true),
+		WithServerLabel("cache", "none"),
+	)
+	for _, v := range []string{"hit", `"m\iss"`} {
+		if _, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if SetLabel(ctx, "unknown", v) {
+				t.Error("undeclared label is set")
+			}
+			if !SetLabel(ctx, "cache", v) {
+				t.Error("declared label is not set")
+			}
+			return nil, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := StreamServerInterceptor(m)(nil, &fakeServerStream{}, &grpc.StreamServerInfo{
+		FullMethod:     "/grpc.health.v1.Health/Watch",
+		IsServerStream: true,
+	}, func(srv interface{}, stream grpc.ServerStream) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if SetLabel(context.Background(), "cache", "hit") {
+		t.Error("label is set outside of a call")
+	}
+
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK",cache="hit"} 1`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK",cache="\"m\\iss\""} 1`,
+		`grpc_server_handling_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",cache="hit"} 1`,
+		`grpc_server_handled_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch",grpc_code="OK",cache="none"} 1`,
+	)
+}
+
+func TestWithServerLabel_invalid(t *testing.T) {
+	for _, name := range []string{"", "1abc", "grpc_code", "a-b"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected a panic", name)
+				}
+			}()
+			_ = WithServerLabel(name, "")
+		}()
+	}
+}
@@ -1,43 +1,46 @@
 package grpcmetrics
 
 import (
-	"fmt"
+	"context"
 	"math"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
-	"github.com/VictoriaMetrics/metrics"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type set struct {
-	*metrics.Set
+func newCounter(name string) *counter {
+	return &counter{newMetric(name)}
 }
 
-func (s *set) counter(name string) any {
-	if s.Set != nil {
-		return s.Set.NewCounter(name)
-	}
-	return metrics.NewCounter(name)
+type counter struct {
+	*metric
 }
 
-func (s *set) histogram(name string) any {
-	if s.Set != nil {
-		return s.Set.NewHistogram(name)
-	}
-	return metrics.NewHistogram(name)
+func (c *counter) with(b Backend, typ, method string, code codes.Code) Counter {
+	return c.metric.with(b, typ, method, code, "", newCounterSeries).v.(Counter)
 }
 
-func newCounter(name string) *counter {
-	return &counter{newMetric(name)}
+// withLabels is like with but appends the given pre-rendered
+// comma-separated list of extra labels to the series name.
+func (c *counter) withLabels(
+	b Backend, typ, method string, code codes.Code, labels string,
+) Counter {
+	return c.metric.with(b, typ, method, code, labels, newCounterSeries).v.(Counter)
 }
 
-type counter struct {
-	*metric
+// pin is like withLabels but the series never expires.
+func (c *counter) pin(b Backend, typ, method string, code codes.Code, labels string) {
+	c.metric.pin(c.metric.with(b, typ, method, code, labels, newCounterSeries))
 }
 
-func (c *counter) with(s *set, typ, method string, code codes.Code) *metrics.Counter {
-	return c.metric.with(typ, method, code, s.counter).(*metrics.Counter)
+func newCounterSeries(b Backend, name string, labels []Label) any {
+	return b.Counter(name, labels)
 }
 
 func newHistogram(name string) *histogram {
@@ -48,26 +51,75 @@ type histogram struct {
 	*metric
 }
 
-func (h *histogram) with(s *set, typ, method string) *metrics.Histogram {
-	return h.metric.with(typ, method, noCode, s.histogram).(*metrics.Histogram)
+func (h *histogram) with(b Backend, typ, method string) Histogram {
+	return h.metric.with(b, typ, method, noCode, "", newHistogramSeries).v.(Histogram)
+}
+
+func (h *histogram) withLabels(b Backend, typ, method, labels string) Histogram {
+	return h.metric.with(b, typ, method, noCode, labels, newHistogramSeries).v.(Histogram)
+}
+
+// pin is like withLabels but the series never expires.
+func (h *histogram) pin(b Backend, typ, method, labels string) {
+	h.metric.pin(h.metric.with(b, typ, method, noCode, labels, newHistogramSeries))
+}
+
+func newHistogramSeries(b Backend, name string, labels []Label) any {
+	return b.Histogram(name, labels)
 }
 
 func newMetric(name string) *metric {
 	return &metric{
 		name:    name,
-		methods: map[string]map[codes.Code]any{},
+		methods: map[string]*methodSeries{},
+		names:   map[seriesID]*series{},
 	}
 }
 
 type metric struct {
 	mu      sync.RWMutex
 	name    string
-	methods map[string]map[codes.Code]any // TODO: use metrics.Metric when it's exported
+	methods map[string]*methodSeries
+
+	// names contains series by rendered names, different methods may
+	// have the same name after sanitizing, so they share series.
+	names map[seriesID]*series
+
+	// track enables updating series last use time, see expirer.
+	track bool
+}
+
+type methodSeries struct {
+	typ    string
+	series map[seriesKey]*series
+}
+
+type series struct {
+	used    int64 // unix nanoseconds, accessed atomically
+	created time.Time
+	name    string // rendered with labels
+	labels  []Label
+	v       any // Counter or Histogram
+	pinned  bool
+	refs    int    // number of keys sharing the series
+	method  string // the method that created the series
+}
+
+type seriesKey struct {
+	backend Backend
+	code    codes.Code
+	labels  string
+}
+
+type seriesID struct {
+	backend Backend
+	name    string
 }
 
 func (m *metric) with(
-	typ, method string, code codes.Code, new func(name string) any,
-) any {
+	b Backend, typ, method string, code codes.Code, labels string,
+	new func(b Backend, name string, labels []Label) any,
+) *series {
 	m.mu.RLock() // try read lock first and promote to write lock if needed
 	var upgraded bool
 	defer func() {
@@ -86,11 +138,15 @@ func (m *metric) with(
 		// r to w mutex upgrading is not atomic,
 		// so we need to check that another routine hasn't got here first
 		if m.methods[method] == nil {
-			m.methods[method] = map[codes.Code]any{}
+			m.methods[method] = &methodSeries{
+				typ:    typ,
+				series: map[seriesKey]*series{},
+			}
 		}
 		methods = m.methods[method]
 	}
-	metric, ok := methods[code]
+	key := seriesKey{b, code, labels}
+	sr, ok := methods.series[key]
 	if !ok {
 		wasUpgraded := upgraded
 		if !upgraded {
@@ -98,39 +154,234 @@ func (m *metric) with(
 			m.mu.RUnlock()
 			m.mu.Lock()
 		}
-		if wasUpgraded || methods[code] == nil {
-			service, method := splitMethodName(method)
-			var b strings.Builder
-			b.Grow(1024) // should be enough for almost all metric names
-			b.WriteString(m.name)
-			b.WriteString(`{grpc_type="`)
-			b.WriteString(typ)
-			b.WriteString(`",grpc_service="`)
-			b.WriteString(service)
-			b.WriteString(`",grpc_method="`)
-			b.WriteString(method)
-			if code != noCode {
-				b.WriteString(`",grpc_code="`)
-				b.WriteString(code.String())
+		if wasUpgraded || methods.series[key] == nil {
+			labels := methodLabels(typ, method, code, labels)
+			id := seriesID{b, renderName(m.name, labels)}
+			sr, ok = m.names[id]
+			if !ok {
+				now := time.Now()
+				sr = &series{
+					used:    now.UnixNano(),
+					created: now,
+					name:    id.name,
+					labels:  labels,
+					v:       new(b, m.name, labels),
+					method:  method,
+				}
+				m.names[id] = sr
+			}
+			sr.refs++
+			methods.series[key] = sr
+		}
+		sr = methods.series[key]
+	}
+	if m.track {
+		atomic.StoreInt64(&sr.used, time.Now().UnixNano())
+	}
+	return sr
+}
+
+// seriesName renders the series name with the method labels,
+// code is omitted when it's noCode and labels are appended as is.
+func seriesName(name, typ, method string, code codes.Code, labels string) string {
+	return renderName(name, methodLabels(typ, method, code, labels))
+}
+
+// methodLabels returns labels of a method series followed by
+// the extra ones parsed from the rendered labels string.
+func methodLabels(typ, method string, code codes.Code, labels string) []Label {
+	service, method := splitMethodName(method)
+	list := []Label{
+		{"grpc_type", typ},
+		{"grpc_service", validUTF8(service)},
+		{"grpc_method", validUTF8(method)},
+	}
+	if code != noCode {
+		list = append(list, Label{"grpc_code", code.String()})
+	}
+	return append(list, parseLabels(labels)...)
+}
+
+func (m *metric) pin(sr *series) {
+	m.mu.Lock()
+	sr.pinned = true
+	m.mu.Unlock()
+}
+
+// expire removes series unused since the given time apart from pinned ones
+// and unregisters them from their backends, it returns the number of removed series.
+func (m *metric) expire(since time.Time) int {
+	deadline := since.UnixNano()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for method, methods := range m.methods {
+		for key, sr := range methods.series {
+			if sr.pinned || atomic.LoadInt64(&sr.used) >= deadline {
+				continue
+			}
+			delete(methods.series, key)
+			if sr.refs--; sr.refs == 0 {
+				key.backend.Unregister(m.name, sr.labels)
+				delete(m.names, seriesID{key.backend, sr.name})
+				n++
+			}
+		}
+		if len(methods.series) == 0 {
+			delete(m.methods, method)
+		}
+	}
+	return n
+}
+
+// seriesOf returns series of the metric recorded into the given backend sorted by name,
+// fields that are read by callers never change after series are created.
+func (m *metric) seriesOf(b Backend) []*series {
+	m.mu.RLock()
+	var list []*series
+	for id, sr := range m.names {
+		if id.backend == b {
+			list = append(list, sr)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+// visit calls fn for every series of the metric, shared
+// series are visited once with the method that created them.
+func (m *metric) visit(fn func(typ, method string, key seriesKey, v any)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for method, methods := range m.methods {
+		for key, sr := range methods.series {
+			if sr.method == method {
+				fn(methods.typ, method, key, sr.v)
 			}
-			b.WriteString(`"}`)
-			methods[code] = new(b.String())
 		}
-		metric = methods[code]
 	}
-	return metric
 }
 
 const noCode = math.MaxUint32
 
+// allCodes is the list of all status codes defined by gRPC.
+var allCodes = [...]codes.Code{
+	codes.OK, codes.Canceled, codes.Unknown, codes.InvalidArgument,
+	codes.DeadlineExceeded, codes.NotFound, codes.AlreadyExists,
+	codes.PermissionDenied, codes.ResourceExhausted, codes.FailedPrecondition,
+	codes.Aborted, codes.OutOfRange, codes.Unimplemented, codes.Internal,
+	codes.Unavailable, codes.DataLoss, codes.Unauthenticated,
+}
+
+// ParseCode returns the status code by its name as
+// it's rendered in grpc_code label values, e.g. "NotFound".
+func ParseCode(s string) (codes.Code, bool) {
+	for _, code := range allCodes {
+		if code.String() == s {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// errorCode is like status.Code but also maps context errors
+// returned as is to Canceled and DeadlineExceeded codes.
+func errorCode(err error) codes.Code {
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return status.FromContextError(err).Code()
+}
+
+// grpc_termination label values, they tell whether the call
+// completed on its own or its context was canceled or timed out
+// by the other side (server) or the caller (client).
+const (
+	terminationCompleted        = `grpc_termination="completed"`
+	terminationCanceled         = `grpc_termination="canceled"`
+	terminationDeadlineExceeded = `grpc_termination="deadline_exceeded"`
+)
+
+func termination(ctx context.Context, code codes.Code) string {
+	if code != codes.OK {
+		switch ctx.Err() {
+		case context.Canceled:
+			return terminationCanceled
+		case context.DeadlineExceeded:
+			return terminationDeadlineExceeded
+		}
+	}
+	return terminationCompleted
+}
+
+// forEachTermination calls fn for code and termination label combinations
+// that are pre-populated by InitializeMetrics.
+func forEachTermination(fn func(code codes.Code, labels string)) {
+	for _, code := range allCodes {
+		fn(code, terminationCompleted)
+	}
+	fn(codes.Canceled, terminationCanceled)
+	fn(codes.DeadlineExceeded, terminationDeadlineExceeded)
+}
+
+// splitMethodName splits "/service/method" into its parts,
+// malformed names end up in the method part with an empty service,
+// because they can come from clients through unknown service handlers.
 func splitMethodName(s string) (string, string) {
 	if len(s) == 0 || s[0] != '/' {
-		panic(fmt.Sprintf("malformed full method: %s", s))
+		return "", s
 	}
 	i := strings.IndexByte(s[1:], '/')
+	if i == -1 {
+		return "", s[1:]
+	}
 	return s[1 : i+1], s[i+2:]
 }
 
+// writeLabelValue writes s escaped according to the prometheus text format,
+// invalid UTF-8 sequences are replaced with utf8.RuneError.
+func writeLabelValue(b *strings.Builder, s string) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch c {
+			case '\\':
+				b.WriteString(`\\`)
+			case '"':
+				b.WriteString(`\"`)
+			case '\n':
+				b.WriteString(`\n`)
+			default:
+				b.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && n == 1 {
+			b.WriteRune(utf8.RuneError)
+		} else {
+			b.WriteString(s[i : i+n])
+		}
+		i += n
+	}
+}
+
+// validUTF8 replaces invalid bytes with utf8.RuneError the same way writeLabelValue does.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func streamType(server, client bool) string {
 	switch {
 	case server && client:
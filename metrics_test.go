@@ -0,0 +1,125 @@
+package grpcmetrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func FuzzSplitMethodName(f *testing.F) {
+	for _, s := range []string{
+		"/grpc.health.v1.Health/Check", "/Service/", "//Method", "/", "", "no/slash", "/a/b/c",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		service, method := splitMethodName(s)
+		if strings.Contains(service, "/") {
+			t.Fatalf("service %q contains a slash", service)
+		}
+		if service != "" && "/"+service+"/"+method != s {
+			t.Fatalf("splitMethodName(%q) = %q, %q", s, service, method)
+		}
+	})
+}
+
+func FuzzSeriesName(f *testing.F) {
+	for _, s := range [][2]string{
+		{"/grpc.health.v1.Health/Check", "hit"},
+		{`/"svc"/m\`, `"v\"`},
+		{"/svc\n/\\n", "a\nb"},
+		{"/\xff\xfe/\xc0", "\xed\xa0\x80"},
+		{"malformed", ""},
+	} {
+		f.Add(s[0], s[1])
+	}
+	f.Fuzz(func(t *testing.T, method, value string) {
+		s := metrics.NewSet()
+		newCounter("grpc_server_handled_total").withLabels(VictoriaMetricsBackend(s), unary, method, codes.OK,
+			renderLabels([]string{"custom"}, []string{value}),
+		).Inc()
+
+		var b bytes.Buffer
+		s.WritePrometheus(&b)
+		families, err := (&expfmt.TextParser{}).TextToMetricFamilies(&b)
+		if err != nil {
+			t.Fatalf("exposition doesn't parse: %s\n%s", err, b.String())
+		}
+		mf := families["grpc_server_handled_total"]
+		if mf == nil || len(mf.Metric) != 1 {
+			t.Fatalf("series not found:\n%s", b.String())
+		}
+		got := map[string]string{}
+		for _, l := range mf.Metric[0].Label {
+			got[l.GetName()] = l.GetValue()
+		}
+		service, name := splitMethodName(method)
+		for k, v := range map[string]string{
+			"grpc_type":    unary,
+			"grpc_service": sanitize(service),
+			"grpc_method":  sanitize(name),
+			"grpc_code":    "OK",
+			"custom":       sanitize(value),
+		} {
+			if got[k] != v {
+				t.Errorf("label %s = %q, want %q", k, got[k], v)
+			}
+		}
+	})
+}
+
+// sanitize replaces every invalid byte with utf8.RuneError the same
+// way writeLabelValue does, unlike strings.ToValidUTF8 that replaces runs.
+func sanitize(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func TestMetric_sanitizedCollision(t *testing.T) {
+	m := newServerMetrics(WithServerSeriesTTL(time.Hour))
+	defer m.Close()
+	for _, method := range []string{"/svc/m\xff", "/svc/m\xfe"} {
+		_, _ = UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: method,
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_started_total{grpc_type="unary",grpc_service="svc",grpc_method="m`+"�"+`"} 2`,
+	)
+	if s := m.Snapshot(); len(s) != 1 || s[0].Started != 2 {
+		t.Fatalf("Snapshot = %+v", s)
+	}
+
+	m.expirer.sweep(time.Now().Add(2 * time.Hour))
+	checkContains(t, vmSet(m.s), `grpc_server_series_expired_total 4`)
+}
+
+func TestServerMetrics_sameSet(t *testing.T) {
+	s := metrics.NewSet()
+	call := func(m *ServerMetrics) {
+		_, _ = UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	}
+	call(NewServerMetrics(WithServerMetricsSet(s)))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("series of two metrics are registered in the same set")
+		}
+	}()
+	call(NewServerMetrics(WithServerMetricsSet(s)))
+}
@@ -0,0 +1,4 @@
+// Package metricspb contains generated code for the grpcmetrics.v1.Metrics service.
+package metricspb
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=github.com/amenzhinsky/grpcmetrics --go-grpc_out=.. --go-grpc_opt=module=github.com/amenzhinsky/grpcmetrics grpcmetrics/v1/metrics.proto
@@ -0,0 +1,186 @@
+package mixin
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+)
+
+type dashboard struct {
+	Title         string      `json:"title"`
+	UID           string      `json:"uid"`
+	Tags          []string    `json:"tags"`
+	SchemaVersion int         `json:"schemaVersion"`
+	Time          timeRange   `json:"time"`
+	Refresh       string      `json:"refresh"`
+	Templating    templating  `json:"templating"`
+	Panels        []*panel    `json:"panels"`
+	Annotations   annotations `json:"annotations"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type annotations struct {
+	List []struct{} `json:"list"`
+}
+
+type panel struct {
+	ID          int          `json:"id"`
+	Type        string       `json:"type"`
+	Title       string       `json:"title"`
+	GridPos     gridPos      `json:"gridPos"`
+	Datasource  *datasource  `json:"datasource,omitempty"`
+	Targets     []target     `json:"targets,omitempty"`
+	FieldConfig *fieldConfig `json:"fieldConfig,omitempty"`
+	Collapsed   *bool        `json:"collapsed,omitempty"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit"`
+	Min  *int   `json:"min,omitempty"`
+}
+
+const (
+	panelWidth  = 12
+	panelHeight = 8
+	legend      = "{{grpc_service}}/{{grpc_method}}"
+)
+
+// Dashboard writes Grafana dashboard JSON with an overview row for all
+// methods and a row per every service listed in the configuration.
+func Dashboard(w io.Writer, c *Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	d := &dashboard{
+		Title:         "gRPC " + c.Prefix[len("grpc_"):],
+		UID:           c.Prefix,
+		Tags:          []string{"grpc", "grpcmetrics"},
+		SchemaVersion: 36,
+		Time:          timeRange{From: "now-1h", To: "now"},
+		Refresh:       "30s",
+		Templating: templating{List: []variable{{
+			Name:  "datasource",
+			Label: "Data source",
+			Type:  "datasource",
+			Query: "prometheus",
+		}}},
+	}
+	if c.Namespace != "" {
+		d.Title += " / " + c.Namespace
+		d.UID += "_" + c.Namespace
+	}
+
+	var y, id int
+	add := func(title string, extra ...string) {
+		id++
+		d.Panels = append(d.Panels, &panel{
+			ID:        id,
+			Type:      "row",
+			Title:     title,
+			GridPos:   gridPos{H: 1, W: 2 * panelWidth, Y: y},
+			Collapsed: new(bool),
+		})
+		y++
+		for i, p := range c.panels(extra...) {
+			id++
+			p.ID = id
+			p.GridPos = gridPos{
+				H: panelHeight,
+				W: panelWidth,
+				X: (i % 2) * panelWidth,
+				Y: y + (i/2)*panelHeight,
+			}
+			d.Panels = append(d.Panels, p)
+		}
+		y += 2 * panelHeight
+	}
+	add("Overview")
+	services := append([]string(nil), c.Services...)
+	sort.Strings(services)
+	for _, service := range services {
+		add(service, "grpc_service="+strconv.Quote(service))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+func (c *Config) panels(extra ...string) []*panel {
+	zero := 0
+	q := "p" + formatFloat(c.LatencyQuantile*100)
+	return []*panel{
+		timeseries("Requests per second", "reqps", nil,
+			target{Expr: c.rateExpr(byMethod, extra...), LegendFormat: legend},
+		),
+		timeseries("Error ratio", "percentunit", &zero,
+			target{Expr: c.errorRatioExpr(byMethod, extra...), LegendFormat: legend},
+		),
+		timeseries("Latency "+q, "s", &zero,
+			target{Expr: c.quantileExpr(c.LatencyQuantile, byMethod, extra...), LegendFormat: legend},
+		),
+		timeseries("In-flight calls", "short", &zero,
+			target{Expr: c.inFlightExpr(byMethod, extra...), LegendFormat: legend},
+		),
+	}
+}
+
+func timeseries(title, unit string, min *int, targets ...target) *panel {
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	return &panel{
+		Type:        "timeseries",
+		Title:       title,
+		Datasource:  &datasource{Type: "prometheus", UID: "${datasource}"},
+		Targets:     targets,
+		FieldConfig: &fieldConfig{Defaults: fieldDefaults{Unit: unit, Min: min}},
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
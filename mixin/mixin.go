@@ -0,0 +1,172 @@
+// Package mixin generates Grafana dashboards and Prometheus/vmalert
+// recording and alerting rules for series produced by grpcmetrics.
+package mixin
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics/internal/promfmt"
+	"google.golang.org/grpc"
+)
+
+type HistogramKind string
+
+const (
+	// VMRange is the kind of histograms produced by VictoriaMetrics,
+	// they can be queried only with MetricsQL.
+	VMRange HistogramKind = "vmrange"
+
+	// LE is the kind of classic prometheus histograms with cumulative buckets.
+	LE HistogramKind = "le"
+)
+
+// DefaultErrorCodes are codes that are usually caused by the server.
+var DefaultErrorCodes = []string{
+	"Unknown", "DeadlineExceeded", "Unimplemented", "Internal", "Unavailable", "DataLoss",
+}
+
+type Config struct {
+	// Prefix is the metric names prefix, grpc_server or grpc_client.
+	Prefix string
+
+	// Namespace is prepended to metric names when set, the same
+	// way as prometheus.Opts.Namespace, e.g. prod_grpc_server_started_total.
+	Namespace string
+
+	// Selector is a list of extra label matchers, e.g. `job="api"`.
+	Selector string
+
+	Histogram HistogramKind
+
+	// ErrorCodes is the list of codes counted as errors.
+	ErrorCodes []string
+
+	// ErrorRatio is the maximum ratio of failed calls before alerting.
+	ErrorRatio float64
+
+	// LatencyQuantile and LatencyThreshold define the latency SLO,
+	// latency rules are not generated when the threshold is zero.
+	LatencyQuantile  float64
+	LatencyThreshold time.Duration
+
+	// Window is the range used for rate calculations.
+	Window time.Duration
+
+	// Services to generate per-service dashboard rows for.
+	Services []string
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Prefix:           "grpc_server",
+		Histogram:        VMRange,
+		ErrorCodes:       DefaultErrorCodes,
+		ErrorRatio:       0.01,
+		LatencyQuantile:  0.99,
+		LatencyThreshold: time.Second,
+		Window:           5 * time.Minute,
+	}
+}
+
+// ServicesFromServer returns sorted names of services registered on the server.
+func ServicesFromServer(s *grpc.Server) []string {
+	info := s.GetServiceInfo()
+	services := make([]string, 0, len(info))
+	for name := range info {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	return services
+}
+
+func (c *Config) validate() error {
+	if c.Prefix != "grpc_server" && c.Prefix != "grpc_client" {
+		return fmt.Errorf("unsupported prefix %q", c.Prefix)
+	}
+	if c.Namespace != "" && !namespaceRe.MatchString(c.Namespace) {
+		return fmt.Errorf("invalid namespace %q", c.Namespace)
+	}
+	if c.Histogram != VMRange && c.Histogram != LE {
+		return fmt.Errorf("unsupported histogram kind %q", c.Histogram)
+	}
+	if len(c.ErrorCodes) == 0 {
+		return errors.New("error codes are empty")
+	}
+	if c.ErrorRatio <= 0 || c.ErrorRatio >= 1 {
+		return errors.New("error ratio must be in (0, 1) range")
+	}
+	if c.LatencyQuantile <= 0 || c.LatencyQuantile >= 1 {
+		return errors.New("latency quantile must be in (0, 1) range")
+	}
+	if c.Window < time.Minute {
+		return errors.New("window must be at least a minute")
+	}
+	return nil
+}
+
+var namespaceRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// prefix returns the metric names prefix including the namespace.
+func (c *Config) prefix() string {
+	if c.Namespace != "" {
+		return c.Namespace + "_" + c.Prefix
+	}
+	return c.Prefix
+}
+
+func (c *Config) metric(suffix string) string {
+	return c.prefix() + "_" + suffix
+}
+
+// selector renders label matchers with the given extra ones.
+func (c *Config) selector(extra ...string) string {
+	var matchers []string
+	if c.Selector != "" {
+		matchers = append(matchers, c.Selector)
+	}
+	matchers = append(matchers, extra...)
+	if len(matchers) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+func (c *Config) window() string {
+	return promfmt.Duration(c.Window)
+}
+
+func (c *Config) errorCodesMatcher() string {
+	return `grpc_code=~"` + strings.Join(c.ErrorCodes, "|") + `"`
+}
+
+const byMethod = "grpc_service, grpc_method"
+
+func (c *Config) rateExpr(by string, extra ...string) string {
+	return fmt.Sprintf("sum(rate(%s%s[%s])) by (%s)",
+		c.metric("handled_total"), c.selector(extra...), c.window(), by)
+}
+
+func (c *Config) errorRatioExpr(by string, extra ...string) string {
+	errs := append(append([]string(nil), extra...), c.errorCodesMatcher())
+	return c.rateExpr(by, errs...) +
+		"\n  /\n" + c.rateExpr(by, extra...)
+}
+
+// quantileExpr takes into account the histogram kind, vmrange buckets
+// are understood natively by MetricsQL histogram_quantile function.
+func (c *Config) quantileExpr(q float64, by string, extra ...string) string {
+	return fmt.Sprintf("histogram_quantile(%s, sum(rate(%s%s[%s])) by (%s, %s))",
+		strconv.FormatFloat(q, 'f', -1, 64), c.metric("handling_seconds_bucket"), c.selector(extra...), c.window(), by, c.Histogram)
+}
+
+func (c *Config) inFlightExpr(by string, extra ...string) string {
+	sel := c.selector(extra...)
+	return fmt.Sprintf("sum(%s%s) by (%s) - sum(%s%s) by (%s)",
+		c.metric("started_total"), sel, by, c.metric("handled_total"), sel, by)
+}
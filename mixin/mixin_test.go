@@ -0,0 +1,68 @@
+package mixin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDashboard(t *testing.T) {
+	s := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+
+	c := DefaultConfig()
+	c.Namespace = "prod"
+	c.Services = ServicesFromServer(s)
+	var b bytes.Buffer
+	if err := Dashboard(&b, c); err != nil {
+		t.Fatal(err)
+	}
+	var d dashboard
+	if err := json.Unmarshal(b.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Panels) != 10 {
+		t.Fatalf("len(panels) = %d, want 10", len(d.Panels))
+	}
+	if d.Panels[5].Title != "grpc.health.v1.Health" {
+		t.Fatalf("row title = %q, want service name", d.Panels[5].Title)
+	}
+	want := `histogram_quantile(0.99, sum(rate(prod_grpc_server_handling_seconds_bucket{grpc_service="grpc.health.v1.Health"}[5m])) by (grpc_service, grpc_method, vmrange))`
+	if got := d.Panels[8].Targets[0].Expr; got != want {
+		t.Fatalf("expr = %s, want %s", got, want)
+	}
+}
+
+func TestRules(t *testing.T) {
+	c := DefaultConfig()
+	c.Prefix = "grpc_client"
+	c.Histogram = LE
+	c.LatencyQuantile = 0.999
+	var b bytes.Buffer
+	if err := Rules(&b, c); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"- record: grpc_service_method:grpc_client_errors:ratio_rate5m\n",
+		"- alert: GRPCClientHighErrorRatio\n",
+		"grpc_service_method:grpc_client_handling_seconds:p99_9_5m > 1\n",
+		"by (grpc_service, grpc_method, le))\n",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Fatalf("rules don't contain %q:\n%s", s, b.String())
+		}
+	}
+}
+
+func TestConfig_validate(t *testing.T) {
+	c := DefaultConfig()
+	c.Histogram = "summary"
+	if err := Rules(&bytes.Buffer{}, c); err == nil {
+		t.Fatal("expected an error")
+	}
+}
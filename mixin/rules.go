@@ -0,0 +1,111 @@
+package mixin
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type rule struct {
+	record, alert string
+	expr          string
+	forDuration   string
+	labels        map[string]string
+	annotations   map[string]string
+}
+
+// recordName follows the level:metric:operations naming convention.
+func (c *Config) recordName(metric, op string) string {
+	return "grpc_service_method:" + c.metric(metric) + ":" + op + c.window()
+}
+
+func (c *Config) rules() []rule {
+	side := strings.TrimPrefix(c.Prefix, "grpc_")
+	title := "GRPC" + strings.ToUpper(side[:1]) + side[1:]
+
+	rules := []rule{
+		{
+			record: c.recordName("handled", "rate"),
+			expr:   c.rateExpr(byMethod + ", grpc_code"),
+		},
+		{
+			record: c.recordName("errors", "ratio_rate"),
+			expr:   c.errorRatioExpr(byMethod),
+		},
+		{
+			alert:       title + "HighErrorRatio",
+			expr:        c.recordName("errors", "ratio_rate") + " > " + formatFloat(c.ErrorRatio),
+			forDuration: c.window(),
+			labels:      map[string]string{"severity": "warning"},
+			annotations: map[string]string{
+				"summary": fmt.Sprintf("%s error ratio of {{ $labels.grpc_service }}/{{ $labels.grpc_method }} is above %s%%",
+					side, formatFloat(c.ErrorRatio*100)),
+			},
+		},
+	}
+	if c.LatencyThreshold > 0 {
+		q := "p" + strings.ReplaceAll(formatFloat(c.LatencyQuantile*100), ".", "_")
+		rules = append(rules,
+			rule{
+				record: c.recordName("handling_seconds", q+"_"),
+				expr:   c.quantileExpr(c.LatencyQuantile, byMethod),
+			},
+			rule{
+				alert:       title + "HighLatency",
+				expr:        c.recordName("handling_seconds", q+"_") + " > " + formatFloat(c.LatencyThreshold.Seconds()),
+				forDuration: c.window(),
+				labels:      map[string]string{"severity": "warning"},
+				annotations: map[string]string{
+					"summary": fmt.Sprintf("%s %s latency of {{ $labels.grpc_service }}/{{ $labels.grpc_method }} is above %s",
+						side, q, c.LatencyThreshold),
+				},
+			},
+		)
+	}
+	return rules
+}
+
+// Rules writes recording and alerting rules in the format
+// understood both by Prometheus and vmalert.
+func Rules(w io.Writer, c *Config) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("groups:\n")
+	b.WriteString("  - name: " + c.prefix() + "\n")
+	b.WriteString("    rules:\n")
+	for _, r := range c.rules() {
+		if r.record != "" {
+			b.WriteString("      - record: " + r.record + "\n")
+		} else {
+			b.WriteString("      - alert: " + r.alert + "\n")
+		}
+		b.WriteString("        expr: |\n")
+		for _, line := range strings.Split(r.expr, "\n") {
+			b.WriteString("          " + line + "\n")
+		}
+		if r.forDuration != "" {
+			b.WriteString("        for: " + r.forDuration + "\n")
+		}
+		writeMap(&b, "labels", r.labels)
+		writeMap(&b, "annotations", r.annotations)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMap(b *strings.Builder, name string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	b.WriteString("        " + name + ":\n")
+	for _, k := range sortedKeys(m) {
+		b.WriteString("          " + k + ": " + strconv.Quote(m[k]) + "\n")
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
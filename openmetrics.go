@@ -0,0 +1,381 @@
+package grpcmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics/internal/promfmt"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	prometheusType  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// help contains descriptions of metric families,
+// window gauges share them regardless of the window suffix.
+var help = map[string]string{
+	"grpc_server_started":                     "Total number of RPCs started on the server.",
+	"grpc_server_handled":                     "Total number of RPCs completed on the server, regardless of success or failure.",
+	"grpc_server_msg_received":                "Total number of RPC stream messages received on the server.",
+	"grpc_server_msg_sent":                    "Total number of gRPC stream messages sent by the server.",
+	"grpc_server_handling_seconds":            "Histogram of response latency of RPCs handled by the server.",
+	"grpc_server_panics":                      "Total number of handler panics on the server.",
+	"grpc_server_series_expired":              "Total number of server series removed after being idle longer than their TTL.",
+	"grpc_server_requests_rate":               "Number of RPCs per second handled by the server over the window.",
+	"grpc_server_error_ratio":                 "Ratio of RPCs handled by the server with non-OK codes over the window.",
+	"grpc_server_handling_seconds_window":     "Quantiles of response latency of RPCs handled by the server over the window.",
+	"grpc_server_queue_seconds":               "Histogram of time RPCs spent between arriving on the transport and reaching interceptors.",
+	"grpc_server_interceptor_seconds":         "Histogram of time RPCs spent in interceptors and handlers.",
+	"grpc_server_post_handler_seconds":        "Histogram of time RPCs spent between handlers returning and the status being written.",
+	"grpc_server_handling_middleware_seconds": "Histogram of time RPCs spent in interceptors between the outer and the handler interceptors.",
+	"grpc_server_handling_handler_seconds":    "Histogram of time RPCs spent in handlers.",
+	"grpc_server_top_callers":                 "Estimated number of RPCs of the busiest callers during the last refresh interval.",
+	"grpc_server_shutdown_inflight_at_start":  "Number of RPCs in flight when the graceful shutdown started.",
+	"grpc_server_shutdown_drain_seconds":      "Histogram of time the graceful shutdown took to drain RPCs.",
+	"grpc_server_shutdown_arrived":            "Total number of RPCs started while the server was draining.",
+
+	"grpc_client_started":                 "Total number of RPCs started on the client.",
+	"grpc_client_handled":                 "Total number of RPCs completed by the client, regardless of success or failure.",
+	"grpc_client_msg_received":            "Total number of RPC stream messages received by the client.",
+	"grpc_client_msg_sent":                "Total number of gRPC stream messages sent by the client.",
+	"grpc_client_handling_seconds":        "Histogram of response latency of RPCs until they're finished by the application.",
+	"grpc_client_series_expired":          "Total number of client series removed after being idle longer than their TTL.",
+	"grpc_client_requests_rate":           "Number of RPCs per second finished by the client over the window.",
+	"grpc_client_error_ratio":             "Ratio of RPCs finished by the client with non-OK codes over the window.",
+	"grpc_client_handling_seconds_window": "Quantiles of response latency of RPCs finished by the client over the window.",
+}
+
+// Help returns the description of the named metric for backends that
+// require one, it's empty for unknown names.
+func Help(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	if s, ok := help[name]; ok {
+		return s
+	}
+	// window gauges end with the window suffix
+	if i := strings.LastIndexByte(name, '_'); i != -1 {
+		if s, ok := help[name[:i]+"_window"]; ok {
+			return s
+		}
+		return help[name[:i]]
+	}
+	return ""
+}
+
+// OpenMetricsWriter is implemented by ServerMetrics and ClientMetrics.
+type OpenMetricsWriter interface {
+	WriteOpenMetrics(w io.Writer)
+}
+
+// Handler serves series of ms in the OpenMetrics text format when the scraper accepts it,
+// otherwise writePrometheus is called, e.g. func(w io.Writer) { metrics.WritePrometheus(w, true) }.
+// Other series written by writePrometheus are converted into OpenMetrics as well,
+// when they can't be parsed the text format is served.
+func Handler(writePrometheus func(w io.Writer), ms ...OpenMetricsWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsOpenMetrics(r.Header.Get("Accept")) {
+			w.Header().Set("Content-Type", prometheusType)
+			writePrometheus(w)
+			return
+		}
+
+		var text bytes.Buffer
+		writePrometheus(&text)
+		families, err := (&expfmt.TextParser{}).TextToMetricFamilies(bytes.NewReader(text.Bytes()))
+		if err != nil {
+			w.Header().Set("Content-Type", prometheusType)
+			_, _ = w.Write(text.Bytes())
+			return
+		}
+
+		var grpc bytes.Buffer
+		for _, m := range ms {
+			m.WriteOpenMetrics(&grpc)
+		}
+		covered := map[string]bool{}
+		for _, line := range strings.Split(grpc.String(), "\n") {
+			if strings.HasPrefix(line, "# TYPE ") {
+				covered[strings.Fields(line)[2]] = true
+			}
+		}
+
+		w.Header().Set("Content-Type", openMetricsType)
+		names := make([]string, 0, len(families))
+		for name := range families {
+			if !coveredFamily(covered, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = expfmt.MetricFamilyToOpenMetrics(w, families[name])
+		}
+		_, _ = w.Write(grpc.Bytes())
+		_, _ = io.WriteString(w, "# EOF\n")
+	})
+}
+
+// coveredFamily reports whether the text format family is written by
+// OpenMetrics writers, the text format has no TYPE lines for series
+// written by backends, so samples are parsed as separate families.
+func coveredFamily(covered map[string]bool, name string) bool {
+	if covered[name] {
+		return true
+	}
+	for _, suffix := range []string{"_total", "_created", "_bucket", "_sum", "_count"} {
+		if strings.HasSuffix(name, suffix) && covered[strings.TrimSuffix(name, suffix)] {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsOpenMetrics reports whether the Accept header lists OpenMetrics
+// with a non-zero quality, prometheus sends it with a higher quality than
+// the plain text format when the scraper supports it.
+func acceptsOpenMetrics(accept string) bool {
+	for _, s := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(s)
+		if err != nil || typ != "application/openmetrics-text" {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// WriteOpenMetrics writes series of m recorded into the default set in the
+// OpenMetrics text format without the "# EOF" line, so outputs of multiple
+// writers can be concatenated, Handler adds it. Histograms have le buckets
+// of prometheus.DefBuckets bounds.
+func (m *ServerMetrics) WriteOpenMetrics(w io.Writer) {
+	c := m.config()
+	om := newOpenMetrics(w, m.s)
+	om.counter(m.started)
+	om.counter(m.handled)
+	om.counter(m.msgRecv)
+	om.counter(m.msgSent)
+	handling, panics := m.exported()
+	if handling != nil {
+		om.histogram(handling)
+	}
+	if panics != nil {
+		om.counter(panics)
+	}
+	om.expired("grpc_server_series_expired", m.expirer)
+	om.windows(c.windows)
+	om.drain(m.drain)
+	if m.phases != nil {
+		om.histogram(m.phases.queue)
+		om.histogram(m.phases.interceptor)
+		om.histogram(m.phases.post)
+	}
+	if m.chain != nil {
+		om.histogram(m.chain.middleware)
+		om.histogram(m.chain.handler)
+	}
+	om.topCallers(m.hitters)
+	_ = om.w.Flush()
+}
+
+// WriteOpenMetrics is the client version of (*ServerMetrics).WriteOpenMetrics.
+func (m *ClientMetrics) WriteOpenMetrics(w io.Writer) {
+	c := m.config()
+	om := newOpenMetrics(w, m.s)
+	om.counter(m.started)
+	om.counter(m.handled)
+	om.counter(m.msgRecv)
+	om.counter(m.msgSent)
+	if handling := m.exported(); handling != nil {
+		om.histogram(handling)
+	}
+	om.expired("grpc_client_series_expired", m.expirer)
+	om.windows(c.windows)
+	_ = om.w.Flush()
+}
+
+type openMetrics struct {
+	w *bufio.Writer
+	b Backend
+}
+
+func newOpenMetrics(w io.Writer, b Backend) *openMetrics {
+	return &openMetrics{w: bufio.NewWriter(w), b: b}
+}
+
+func (om *openMetrics) family(name, typ, unit, help string) {
+	om.w.WriteString("# TYPE " + name + " " + typ + "\n")
+	if unit != "" {
+		om.w.WriteString("# UNIT " + name + " " + unit + "\n")
+	}
+	om.w.WriteString("# HELP " + name + " " + help + "\n")
+}
+
+// sample writes a single line, labels include braces.
+func (om *openMetrics) sample(name, labels, value string) {
+	om.w.WriteString(name)
+	om.w.WriteString(labels)
+	om.w.WriteByte(' ')
+	om.w.WriteString(value)
+	om.w.WriteByte('\n')
+}
+
+func (om *openMetrics) counter(c *counter) {
+	list := c.seriesOf(om.b)
+	if len(list) == 0 {
+		return
+	}
+	name := strings.TrimSuffix(c.name, "_total")
+	om.family(name, "counter", "", help[name])
+	for _, sr := range list {
+		labels := sr.name[len(c.name):]
+		om.sample(name+"_total", labels, strconv.FormatUint(sr.v.(Counter).Get(), 10))
+		om.sample(name+"_created", labels, formatTimestamp(sr.created))
+	}
+}
+
+// histogram converts buckets into cumulative le ones.
+func (om *openMetrics) histogram(h *histogram) {
+	list := h.seriesOf(om.b)
+	if len(list) == 0 {
+		return
+	}
+	om.family(h.name, "histogram", "seconds", help[h.name])
+	for _, sr := range list {
+		om.histogramSample(h.name, sr.name[len(h.name):], sr.v.(Histogram).Stats(), sr.created)
+	}
+}
+
+func (om *openMetrics) histogramSample(name, labels string, stats *HistogramStats, created time.Time) {
+	for i, n := range stats.cumulative() {
+		om.sample(name+"_bucket", withLabel(labels, "le", formatFloat(leBounds[i])), strconv.FormatUint(n, 10))
+	}
+	om.sample(name+"_bucket", withLabel(labels, "le", "+Inf"), strconv.FormatUint(stats.Count, 10))
+	om.sample(name+"_sum", labels, formatFloat(stats.Sum))
+	om.sample(name+"_count", labels, strconv.FormatUint(stats.Count, 10))
+	om.sample(name+"_created", labels, formatTimestamp(created))
+}
+
+func (om *openMetrics) expired(name string, e *expirer) {
+	if e == nil {
+		return
+	}
+	om.family(name, "counter", "", help[name])
+	om.sample(name+"_total", "", strconv.FormatUint(e.expired.Get(), 10))
+	om.sample(name+"_created", "", formatTimestamp(e.created))
+}
+
+func (om *openMetrics) drain(d *drain) {
+	if d == nil {
+		return
+	}
+	const inflight = "grpc_server_shutdown_inflight_at_start"
+	om.family(inflight, "gauge", "", help[inflight])
+	for i, typ := range streamTypes {
+		om.sample(inflight, `{grpc_type="`+typ+`"}`, strconv.FormatInt(atomic.LoadInt64(&d.atStart[i]), 10))
+	}
+	const duration = "grpc_server_shutdown_drain_seconds"
+	om.family(duration, "histogram", "seconds", help[duration])
+	om.histogramSample(duration, "", d.duration.Stats(), d.created)
+	om.counter(d.arrived)
+}
+
+func (om *openMetrics) topCallers(h *hitters) {
+	const name = "grpc_server_top_callers"
+	var started bool
+	h.each(func(key callerKey, c CallerStats) {
+		if !started {
+			om.family(name, "gauge", "", help[name])
+			started = true
+		}
+		labels := renderLabels([]string{"grpc_caller"}, []string{key.caller})
+		om.sample(name, labelsOf(key.typ, key.method, labels), strconv.FormatUint(c.Calls, 10))
+	})
+}
+
+// windows writes window gauges of all methods regardless of
+// whether gauges are registered in the set.
+func (om *openMetrics) windows(w *windows) {
+	if w == nil {
+		return
+	}
+	type method struct{ typ, name string }
+	var methods []method
+	w.mu.RLock()
+	for name, win := range w.methods {
+		methods = append(methods, method{win.typ, name})
+	}
+	w.mu.RUnlock()
+	if len(methods) == 0 {
+		return
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].name < methods[j].name
+	})
+
+	now := time.Now()
+	stats := make([][]WindowStats, len(methods))
+	for i, m := range methods {
+		for _, d := range Windows {
+			s, _ := w.stats(m.name, d, now)
+			stats[i] = append(stats[i], s)
+		}
+	}
+	for j, d := range Windows {
+		suffix := "_" + promfmt.Duration(d)
+		family := w.prefix + "_requests_rate" + suffix
+		om.family(family, "gauge", "", help[w.prefix+"_requests_rate"])
+		for i, m := range methods {
+			om.sample(family, labelsOf(m.typ, m.name, ""), formatFloat(stats[i][j].Rate()))
+		}
+		family = w.prefix + "_error_ratio" + suffix
+		om.family(family, "gauge", "", help[w.prefix+"_error_ratio"])
+		for i, m := range methods {
+			om.sample(family, labelsOf(m.typ, m.name, ""), formatFloat(stats[i][j].ErrorRatio()))
+		}
+		family = w.prefix + "_handling_seconds" + suffix
+		om.family(family, "gauge", "", help[w.prefix+"_handling_seconds_window"])
+		for i, m := range methods {
+			for _, q := range WindowQuantiles {
+				labels := labelsOf(m.typ, m.name, `quantile="`+formatFloat(q)+`"`)
+				om.sample(family, labels, formatFloat(stats[i][j].Handling.Quantile(q)))
+			}
+		}
+	}
+}
+
+// labelsOf renders labels of a method including braces.
+func labelsOf(typ, method, labels string) string {
+	return seriesName("", typ, method, noCode, labels)
+}
+
+// withLabel appends a label to the rendered labels that include braces.
+func withLabel(labels, name, value string) string {
+	if labels == "" {
+		return "{" + name + `="` + value + `"}`
+	}
+	return labels[:len(labels)-1] + "," + name + `="` + value + `"}`
+}
+
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
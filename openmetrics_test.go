@@ -0,0 +1,171 @@
+package grpcmetrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+func TestServerMetrics_WriteOpenMetrics(t *testing.T) {
+	m := newServerMetrics(
+		WithServerHandlingTimeHistogram(true),
+		WithServerWindowStats(true),
+	)
+	if _, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(func(w io.Writer) {
+		vmSet(m.s).WritePrometheus(w)
+	}, m))
+	defer srv.Close()
+
+	body, typ := scrape(t, srv.URL, "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	if !strings.HasPrefix(typ, "application/openmetrics-text") {
+		t.Fatalf("content type = %q", typ)
+	}
+	for _, s := range []string{
+		"# TYPE grpc_server_started counter\n# HELP grpc_server_started Total number of RPCs started on the server.\n",
+		`grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1` + "\n",
+		`grpc_server_started_created{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} `,
+		"# TYPE grpc_server_handling_seconds histogram\n# UNIT grpc_server_handling_seconds seconds\n",
+		`grpc_server_handling_seconds_bucket{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",le="+Inf"} 1` + "\n",
+		`grpc_server_handling_seconds_sum{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} `,
+		`grpc_server_handling_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1` + "\n",
+		"# TYPE grpc_server_error_ratio_1m gauge\n",
+		`grpc_server_error_ratio_1m{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0` + "\n",
+	} {
+		if !strings.Contains(body, s) {
+			t.Fatalf("output doesn't contain %q:\n%s", s, body)
+		}
+	}
+	if !strings.HasSuffix(body, "\n# EOF\n") {
+		t.Fatalf("no EOF line:\n%s", body)
+	}
+
+	// every family is written at once
+	seen := map[string]bool{}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			name := strings.Fields(line)[2]
+			if seen[name] {
+				t.Fatalf("family %s is split", name)
+			}
+			seen[name] = true
+		}
+	}
+
+	for _, accept := range []string{"", "text/plain", "application/openmetrics-text;q=0"} {
+		body, typ = scrape(t, srv.URL, accept)
+		if !strings.HasPrefix(typ, "text/plain") || strings.Contains(body, "# EOF") {
+			t.Fatalf("Accept %q: unexpected %q response:\n%s", accept, typ, body)
+		}
+	}
+}
+
+func TestHandler_otherSeries(t *testing.T) {
+	s := metrics.NewSet()
+	m := NewServerMetrics(WithServerMetricsSet(s), WithServerHandlingTimeHistogram(true))
+	s.NewCounter(`app_requests_total{path="/"}`).Inc()
+	if _, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(s.WritePrometheus, m))
+	defer srv.Close()
+
+	// the default scrape Accept header of prometheus
+	body, typ := scrape(t, srv.URL, "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,"+
+		"text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+	if !strings.HasPrefix(typ, "application/openmetrics-text") {
+		t.Fatalf("content type = %q", typ)
+	}
+	for _, s := range []string{
+		"# TYPE app_requests_total unknown\n",
+		`app_requests_total{path="/"} 1.0` + "\n",
+		`grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1` + "\n",
+	} {
+		if !strings.Contains(body, s) {
+			t.Fatalf("output doesn't contain %q:\n%s", s, body)
+		}
+	}
+	for _, s := range []string{"vmrange", "# TYPE grpc_server_started_total", "# TYPE grpc_server_handling_seconds_count"} {
+		if strings.Contains(body, s) {
+			t.Fatalf("grpc series are written twice, found %q:\n%s", s, body)
+		}
+	}
+	if !strings.HasSuffix(body, "\n# EOF\n") {
+		t.Fatalf("no EOF line:\n%s", body)
+	}
+}
+
+func TestClientMetrics_WriteOpenMetrics_empty(t *testing.T) {
+	var b strings.Builder
+	m := NewClientMetrics(WithClientMetricsSet(metrics.NewSet()))
+	m.WriteOpenMetrics(&b)
+	if b.String() != "" {
+		t.Fatalf("unexpected output of unused metrics:\n%s", b.String())
+	}
+}
+
+// checkExposed checks that families are written by WriteOpenMetrics
+// and collected by Collector, counters are named without _total.
+func checkExposed(t *testing.T, m *ServerMetrics, families ...string) {
+	t.Helper()
+	var b strings.Builder
+	m.WriteOpenMetrics(&b)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m.Collector())
+	gathered, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range families {
+		if !strings.Contains(b.String(), "# TYPE "+name+" ") {
+			t.Errorf("OpenMetrics output doesn't contain %s:\n%s", name, b.String())
+		}
+		var found bool
+		for _, mf := range gathered {
+			if mf.GetName() == name || mf.GetName() == name+"_total" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s isn't collected", name)
+		}
+	}
+}
+
+func scrape(t *testing.T, url, accept string) (string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", accept)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), res.Header.Get("Content-Type")
+}
@@ -0,0 +1,104 @@
+package grpcmetrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/stats"
+)
+
+// StatsHandler returns a handler that splits the server-side latency of calls into:
+//
+//   - grpc_server_queue_seconds, from the stream arriving on the transport
+//     until the interceptor chain starts, it includes decoding unary requests
+//   - grpc_server_interceptor_seconds, from the interceptor until the handler returns
+//   - grpc_server_post_handler_seconds, from the handler return until the status is written
+//
+// It's used with the interceptors and must be installed before the server starts:
+//
+//	grpc.NewServer(grpc.StatsHandler(m.StatsHandler()), ...)
+func (m *ServerMetrics) StatsHandler() stats.Handler {
+	if m.phases == nil {
+		m.phases = &phases{
+			m:           m,
+			queue:       newHistogram("grpc_server_queue_seconds"),
+			interceptor: newHistogram("grpc_server_interceptor_seconds"),
+			post:        newHistogram("grpc_server_post_handler_seconds"),
+		}
+		for _, h := range []*histogram{m.phases.queue, m.phases.interceptor, m.phases.post} {
+			m.expirer.track(h.metric)
+		}
+	}
+	return m.phases
+}
+
+type phases struct {
+	m                        *ServerMetrics
+	queue, interceptor, post *histogram
+}
+
+// phaseTimes are timestamps of a single call, they're set by the transport,
+// then by the interceptor and read at the end of the call, so no locking needed.
+type phaseTimes struct {
+	method       string
+	typ          string
+	arrived      time.Time
+	handlerStart time.Time
+	handlerEnd   time.Time
+}
+
+type phaseTimesKey struct{}
+
+// enter marks the interceptor start, it returns nil when p is nil
+// or the call hasn't been tagged by the handler.
+func (p *phases) enter(ctx context.Context) *phaseTimes {
+	if p == nil {
+		return nil
+	}
+	t, _ := ctx.Value(phaseTimesKey{}).(*phaseTimes)
+	if t != nil {
+		t.handlerStart = time.Now()
+	}
+	return t
+}
+
+func (t *phaseTimes) exit() {
+	if t != nil {
+		t.handlerEnd = time.Now()
+	}
+}
+
+func (p *phases) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, phaseTimesKey{}, &phaseTimes{method: info.FullMethodName})
+}
+
+func (p *phases) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	t, _ := ctx.Value(phaseTimesKey{}).(*phaseTimes)
+	if t == nil || s.IsClient() {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.InHeader:
+		t.arrived = time.Now()
+	case *stats.Begin:
+		if t.arrived.IsZero() {
+			t.arrived = s.BeginTime
+		}
+		t.typ = streamType(s.IsServerStream, s.IsClientStream)
+	case *stats.End:
+		// calls rejected before reaching interceptors aren't accounted
+		if t.handlerStart.IsZero() || t.handlerEnd.IsZero() {
+			return
+		}
+		b := p.m.set(ctx)
+		p.queue.with(b, t.typ, t.method).Update(t.handlerStart.Sub(t.arrived).Seconds())
+		p.interceptor.with(b, t.typ, t.method).Update(t.handlerEnd.Sub(t.handlerStart).Seconds())
+		p.post.with(b, t.typ, t.method).Update(s.EndTime.Sub(t.handlerEnd).Seconds())
+	}
+}
+
+func (p *phases) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (p *phases) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,57 @@
+package grpcmetrics
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServerMetrics_StatsHandler(t *testing.T) {
+	m := newServerMetrics()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.StatsHandler(m.StatsHandler()),
+		grpc.UnaryInterceptor(UnaryServerInterceptor(m)),
+	)
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	defer s.Stop()
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	if _, err := grpc_health_v1.NewHealthClient(cc).Check(
+		context.Background(), &grpc_health_v1.HealthCheckRequest{},
+	); err != nil {
+		t.Fatal(err)
+	}
+	// the status is written after the client may have received it
+	s.GracefulStop()
+
+	checkContains(t, vmSet(m.s),
+		`grpc_server_queue_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+		`grpc_server_interceptor_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+		`grpc_server_post_handler_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+	)
+	checkExposed(t, m,
+		"grpc_server_queue_seconds",
+		"grpc_server_interceptor_seconds",
+		"grpc_server_post_handler_seconds",
+	)
+}
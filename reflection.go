@@ -0,0 +1,118 @@
+package grpcmetrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// reflectionMethods are tried in order, grpc.reflection.v1 messages are
+// identical to v1alpha ones, so the same types are used for both.
+var reflectionMethods = [...]string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+var reflectionStreamDesc = grpc.StreamDesc{
+	StreamName:    "ServerReflectionInfo",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// InitializeMetricsFromReflection pre-populates client metrics with all
+// services listed by the server reflection service available through cc,
+// it's useful for proxies and gateways that don't link generated code.
+// The v1 reflection service is used, or v1alpha when it's not implemented.
+func (m *ClientMetrics) InitializeMetricsFromReflection(
+	ctx context.Context, cc grpc.ClientConnInterface,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stream grpc.ClientStream
+	var res *rpb.ServerReflectionResponse
+	for i, method := range reflectionMethods {
+		var err error
+		stream, err = cc.NewStream(ctx, &reflectionStreamDesc, method)
+		if err != nil {
+			return err
+		}
+		res, err = reflectionCall(stream, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+		})
+		if status.Code(err) == codes.Unimplemented && i < len(reflectionMethods)-1 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		break
+	}
+	services := res.GetListServicesResponse().GetService()
+
+	// the reflection service sends every file only once per stream
+	// so we need to accumulate all of them to resolve dependencies
+	var files descriptorpb.FileDescriptorSet
+	for _, s := range services {
+		res, err := reflectionCall(stream, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: s.Name,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fd); err != nil {
+				return fmt.Errorf("%s: %w", s.Name, err)
+			}
+			files.File = append(files.File, fd)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	reg, err := protodesc.NewFiles(&files)
+	if err != nil {
+		return err
+	}
+	for _, s := range services {
+		desc, err := reg.FindDescriptorByName(protoreflect.FullName(s.Name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		sd, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return fmt.Errorf("%s is not a service", s.Name)
+		}
+		m.initializeService(sd)
+	}
+	return nil
+}
+
+func reflectionCall(
+	stream grpc.ClientStream, req *rpb.ServerReflectionRequest,
+) (*rpb.ServerReflectionResponse, error) {
+	// io.EOF means the stream is closed by the server, its status is returned by RecvMsg
+	if err := stream.SendMsg(req); err != nil && err != io.EOF {
+		return nil, err
+	}
+	res := &rpb.ServerReflectionResponse{}
+	if err := stream.RecvMsg(res); err != nil {
+		return nil, err
+	}
+	if e := res.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.ErrorCode), e.ErrorMessage)
+	}
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package grpcmetrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClientMetrics_InitializeMetricsFromReflection(t *testing.T) {
+	s := newServer()
+	reflection.Register(s)
+	m := initializeFromReflection(t, s)
+	checkContains(t, vmSet(m.s),
+		`grpc_client_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
+		`grpc_client_handled_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch",grpc_code="Unavailable"} 0`,
+		`grpc_client_started_total{grpc_type="bidi_stream",grpc_service="grpc.reflection.v1alpha.ServerReflection",grpc_method="ServerReflectionInfo"} 0`,
+	)
+}
+
+func TestClientMetrics_InitializeMetricsFromReflection_v1(t *testing.T) {
+	s := newServer()
+	desc := rpb.ServerReflection_ServiceDesc
+	desc.ServiceName = "grpc.reflection.v1.ServerReflection"
+	s.RegisterService(&desc, reflection.NewServer(reflection.ServerOptions{
+		Services: withoutService{s, desc.ServiceName}, // it has no descriptor
+	}))
+	m := initializeFromReflection(t, s)
+	checkContains(t, vmSet(m.s),
+		`grpc_client_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
+	)
+}
+
+type withoutService struct {
+	s    *grpc.Server
+	name string
+}
+
+func (s withoutService) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := s.s.GetServiceInfo()
+	delete(info, s.name)
+	return info
+}
+
+func initializeFromReflection(t *testing.T, s *grpc.Server) *ClientMetrics {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newClientMetrics()
+	if err := m.InitializeMetricsFromReflection(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
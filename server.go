@@ -2,6 +2,8 @@ package grpcmetrics
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
@@ -16,60 +18,169 @@ type ServerOption func(m *ServerMetrics)
 
 func WithServerHandlingTimeHistogram(enable bool) ServerOption {
 	return func(m *ServerMetrics) {
-		if enable {
+		if !enable {
+			m.next.handling = nil
+			return
+		}
+		if m.handling == nil {
 			m.handling = newHistogram("grpc_server_handling_seconds")
+			m.expirer.track(m.handling.metric)
 		}
+		m.next.handling = m.handling
+	}
+}
+
+// WithServerPanicsCounter counts handler panics in grpc_server_panics_total,
+// the call is accounted as handled with codes.Internal and the panic isn't
+// recovered, so it crashes the program with the handler's stack trace.
+func WithServerPanicsCounter(enable bool) ServerOption {
+	return func(m *ServerMetrics) {
+		if !enable {
+			m.next.panics = nil
+			return
+		}
+		m.next.panics = m.panicsCounter()
+	}
+}
+
+// PanicHandler converts a recovered handler panic into an error returned to the caller.
+type PanicHandler func(ctx context.Context, p interface{}) error
+
+// WithServerPanicRecovery is like WithServerPanicsCounter but instead of re-raising
+// panics it recovers them and returns the error produced by h to the caller,
+// when h is nil an Internal status error is returned.
+func WithServerPanicRecovery(h PanicHandler) ServerOption {
+	return func(m *ServerMetrics) {
+		if h == nil {
+			h = defaultPanicHandler
+		}
+		m.next.panics = m.panicsCounter()
+		m.next.recoverPanic = h
+	}
+}
+
+func defaultPanicHandler(ctx context.Context, p interface{}) error {
+	return status.Errorf(codes.Internal, "panic: %v", p)
+}
+
+func (m *ServerMetrics) panicsCounter() *counter {
+	if m.panics == nil {
+		m.panics = newCounter("grpc_server_panics_total")
+		m.expirer.track(m.panics.metric)
+	}
+	return m.panics
+}
+
+// WithServerTerminationLabel adds grpc_termination label to grpc_server_handled_total
+// that distinguishes calls canceled or timed out by clients from the ones
+// that failed on their own with the same codes.
+func WithServerTerminationLabel(enable bool) ServerOption {
+	return func(m *ServerMetrics) {
+		m.next.termination = enable
 	}
 }
 
 func WithServerMetricsSet(s *metrics.Set) ServerOption {
 	return func(m *ServerMetrics) {
-		m.s = &set{s}
+		m.mustNotUpdate("WithServerMetricsSet")
+		m.s = &vmBackend{s}
 	}
 }
 
 func NewServerMetrics(opts ...ServerOption) *ServerMetrics {
 	s := &ServerMetrics{
-		s:       &set{},
+		s:       &vmBackend{},
 		started: newCounter("grpc_server_started_total"),
 		handled: newCounter("grpc_server_handled_total"),
 		msgSent: newCounter("grpc_server_msg_sent_total"),
 		msgRecv: newCounter("grpc_server_msg_received_total"),
 	}
-	for _, opt := range opts {
-		opt(s)
+	s.cfg.Store(&serverConfig{})
+	s.apply(false, opts)
+	if _, ok := s.s.(*vmBackend); s.tenants != nil && !ok {
+		panic("WithServerTenantSets requires the VictoriaMetrics backend")
+	}
+	if s.ttl > 0 {
+		s.expirer = newExpirer(s.ttl, s.s, "grpc_server_series_expired_total",
+			s.started.metric, s.handled.metric, s.msgSent.metric, s.msgRecv.metric,
+			s.handling.metricOrNil(), s.panics.metricOrNil(),
+		)
+		s.expirer.trackWindows(s.windows)
 	}
+	if s.hitters != nil {
+		s.hitters.start(s.s)
+	}
+	s.identity.start()
 	return s
 }
 
 type ServerMetrics struct {
-	s        *set
+	s        Backend
 	started  *counter
 	handled  *counter
 	msgSent  *counter
 	msgRecv  *counter
+	labels   *customLabels
+	identity *identities
+	tenants  *tenantSets
+	ttl      time.Duration
+	expirer  *expirer
+	drain    *drain
+	phases   *phases
+	chain    *chain
+	hitters  *hitters
+
+	mu       sync.Mutex   // serializes updates
+	cfg      atomic.Value // *serverConfig
+	next     *serverConfig
+	updating bool
+
+	// optional metrics are kept when they're disabled by Update,
+	// so enabling them again continues the same series
 	handling *histogram
+	panics   *counter
+	windows  *windows
+}
+
+// serverConfig contains settings that can be changed by Update,
+// every call uses the config that is current when the call starts.
+type serverConfig struct {
+	handling     *histogram
+	panics       *counter
+	recoverPanic PanicHandler
+	termination  bool
+	windows      *windows
+}
+
+func (m *ServerMetrics) config() *serverConfig {
+	return m.cfg.Load().(*serverConfig)
 }
 
 func (m *ServerMetrics) InitializeMetrics(s *grpc.Server) {
+	c := m.config()
 	for service, info := range s.GetServiceInfo() {
 		for _, method := range info.Methods {
 			typ := streamType(method.IsServerStream, method.IsClientStream)
 			fullMethod := "/" + service + "/" + method.Name
-			_ = m.started.with(m.s, typ, fullMethod, noCode)
-			_ = m.msgSent.with(m.s, typ, fullMethod, noCode)
-			_ = m.msgRecv.with(m.s, typ, fullMethod, noCode)
-			for _, code := range [...]codes.Code{
-				codes.OK, codes.Canceled, codes.Unknown, codes.InvalidArgument,
-				codes.DeadlineExceeded, codes.NotFound, codes.AlreadyExists,
-				codes.PermissionDenied, codes.ResourceExhausted, codes.FailedPrecondition,
-				codes.Aborted, codes.OutOfRange, codes.Unimplemented, codes.Internal,
-				codes.Unavailable, codes.DataLoss, codes.Unauthenticated,
-			} {
-				_ = m.handled.with(m.s, typ, fullMethod, code)
+			m.started.pin(m.s, typ, fullMethod, noCode, "")
+			m.msgSent.pin(m.s, typ, fullMethod, noCode, "")
+			m.msgRecv.pin(m.s, typ, fullMethod, noCode, "")
+			custom := m.labels.renderFallbacks()
+			handledCustom := joinLabels(m.identity.renderFallback(), custom)
+			if c.termination {
+				forEachTermination(func(code codes.Code, labels string) {
+					m.handled.pin(m.s, typ, fullMethod, code, joinLabels(labels, handledCustom))
+				})
+			} else {
+				for _, code := range allCodes {
+					m.handled.pin(m.s, typ, fullMethod, code, handledCustom)
+				}
 			}
-			if m.handling != nil {
-				_ = m.handling.with(m.s, typ, fullMethod)
+			if c.handling != nil {
+				c.handling.pin(m.s, typ, fullMethod, custom)
+			}
+			if c.panics != nil {
+				c.panics.pin(m.s, typ, fullMethod, noCode, "")
 			}
 		}
 	}
@@ -81,20 +192,59 @@ func UnaryServerInterceptor(m *ServerMetrics) grpc.UnaryServerInterceptor {
 		req interface{},
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
-	) (interface{}, error) {
+	) (res interface{}, err error) {
+		pt := m.phases.enter(ctx)
+		c := m.config()
 		var startedAt time.Time
-		if m.handling != nil {
+		if c.handling != nil || c.windows != nil {
 			startedAt = time.Now()
 		}
-		m.started.with(m.s, unary, info.FullMethod, noCode).Inc()
-		m.msgRecv.with(m.s, unary, info.FullMethod, noCode).Inc()
-		res, err := handler(ctx, req)
-		m.handled.with(m.s, unary, info.FullMethod, status.Code(err)).Inc()
+		s := m.set(ctx)
+		if m.drain != nil {
+			open := m.drain.start(s, unary, info.FullMethod)
+			defer m.drain.finish(unary, open)
+		}
+		m.started.with(s, unary, info.FullMethod, noCode).Inc()
+		if m.hitters != nil {
+			m.hitters.observe(ctx, unary, info.FullMethod)
+		}
+		m.msgRecv.with(s, unary, info.FullMethod, noCode).Inc()
+		if m.labels != nil {
+			ctx = m.labels.newContext(ctx)
+		}
+		var returned bool
+		if c.panics != nil || c.recoverPanic != nil {
+			defer func() {
+				if returned {
+					return
+				}
+				// panics aren't recovered just to be re-raised,
+				// so crash traces keep the handler's stack
+				if c.recoverPanic == nil {
+					m.accountPanic(ctx, c, s, unary, info.FullMethod, startedAt)
+					return
+				}
+				if p := recover(); p != nil {
+					m.accountPanic(ctx, c, s, unary, info.FullMethod, startedAt)
+					err = c.recoverPanic(ctx, p)
+				}
+			}()
+		}
+		ctx, ct := m.chain.enter(ctx)
+		res, err = handler(ctx, req)
+		returned = true
+		pt.exit()
+		m.chain.exit(s, unary, info.FullMethod, ct)
+		code := errorCode(err)
+		m.handled.withLabels(s, unary, info.FullMethod, code, m.handledLabels(ctx, c, code)).Inc()
 		if err == nil {
-			m.msgSent.with(m.s, unary, info.FullMethod, noCode).Inc()
+			m.msgSent.with(s, unary, info.FullMethod, noCode).Inc()
+		}
+		if c.handling != nil {
+			c.handling.withLabels(s, unary, info.FullMethod, m.labels.render(ctx)).UpdateDuration(startedAt)
 		}
-		if m.handling != nil {
-			m.handling.with(m.s, unary, info.FullMethod).UpdateDuration(startedAt)
+		if c.windows != nil {
+			c.windows.observe(unary, info.FullMethod, code, startedAt)
 		}
 		return res, err
 	}
@@ -106,36 +256,108 @@ func StreamServerInterceptor(m *ServerMetrics) grpc.StreamServerInterceptor {
 		ss grpc.ServerStream,
 		info *grpc.StreamServerInfo,
 		handler grpc.StreamHandler,
-	) error {
+	) (err error) {
+		ctx := ss.Context()
+		pt := m.phases.enter(ctx)
+		c := m.config()
 		var startedAt time.Time
-		if m.handling != nil {
+		if c.handling != nil || c.windows != nil {
 			startedAt = time.Now()
 		}
 		typ := streamType(info.IsServerStream, info.IsClientStream)
-		m.started.with(m.s, typ, info.FullMethod, noCode).Inc()
-		err := handler(srv, &serverStream{
-			ss,
-			m, typ, info.FullMethod,
+		s := m.set(ctx)
+		if m.drain != nil {
+			open := m.drain.start(s, typ, info.FullMethod)
+			defer m.drain.finish(typ, open)
+		}
+		m.started.with(s, typ, info.FullMethod, noCode).Inc()
+		if m.hitters != nil {
+			m.hitters.observe(ctx, typ, info.FullMethod)
+		}
+		if m.labels != nil {
+			ctx = m.labels.newContext(ctx)
+		}
+		var returned bool
+		if c.panics != nil || c.recoverPanic != nil {
+			defer func() {
+				if returned {
+					return
+				}
+				// panics aren't recovered just to be re-raised,
+				// so crash traces keep the handler's stack
+				if c.recoverPanic == nil {
+					m.accountPanic(ctx, c, s, typ, info.FullMethod, startedAt)
+					return
+				}
+				if p := recover(); p != nil {
+					m.accountPanic(ctx, c, s, typ, info.FullMethod, startedAt)
+					err = c.recoverPanic(ctx, p)
+				}
+			}()
+		}
+		ctx, ct := m.chain.enter(ctx)
+		err = handler(srv, &serverStream{
+			ss, ctx,
+			m, s, typ, info.FullMethod,
 		})
-		m.handled.with(m.s, typ, info.FullMethod, status.Code(err)).Inc()
-		if m.handling != nil {
-			m.handling.with(m.s, typ, info.FullMethod).UpdateDuration(startedAt)
+		returned = true
+		pt.exit()
+		m.chain.exit(s, typ, info.FullMethod, ct)
+		code := errorCode(err)
+		m.handled.withLabels(s, typ, info.FullMethod, code, m.handledLabels(ctx, c, code)).Inc()
+		if c.handling != nil {
+			c.handling.withLabels(s, typ, info.FullMethod, m.labels.render(ctx)).UpdateDuration(startedAt)
+		}
+		if c.windows != nil {
+			c.windows.observe(typ, info.FullMethod, code, startedAt)
 		}
 		return err
 	}
 }
 
+// accountPanic accounts a call whose handler panicked.
+func (m *ServerMetrics) accountPanic(
+	ctx context.Context, c *serverConfig, s Backend, typ, method string, startedAt time.Time,
+) {
+	if c.panics != nil {
+		c.panics.with(s, typ, method, noCode).Inc()
+	}
+	m.handled.withLabels(s, typ, method, codes.Internal, m.handledLabels(ctx, c, codes.Internal)).Inc()
+	if c.handling != nil {
+		c.handling.withLabels(s, typ, method, m.labels.render(ctx)).UpdateDuration(startedAt)
+	}
+	if c.windows != nil {
+		c.windows.observe(typ, method, codes.Internal, startedAt)
+	}
+}
+
+// handledLabels returns extra labels for grpc_server_handled_total.
+func (m *ServerMetrics) handledLabels(ctx context.Context, c *serverConfig, code codes.Code) string {
+	var labels string
+	if c.termination {
+		labels = termination(ctx, code)
+	}
+	return joinLabels(joinLabels(labels, m.identity.render(ctx)), m.labels.render(ctx))
+}
+
 type serverStream struct {
 	grpc.ServerStream
 
+	// ctx carries the call's custom labels
+	ctx         context.Context
 	m           *ServerMetrics
+	s           Backend
 	typ, method string
 }
 
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
 func (ss *serverStream) SendMsg(m interface{}) error {
 	err := ss.ServerStream.SendMsg(m)
 	if err == nil {
-		ss.m.msgSent.with(ss.m.s, ss.typ, ss.method, noCode).Inc()
+		ss.m.msgSent.with(ss.s, ss.typ, ss.method, noCode).Inc()
 	}
 	return err
 }
@@ -143,7 +365,7 @@ func (ss *serverStream) SendMsg(m interface{}) error {
 func (ss *serverStream) RecvMsg(m interface{}) error {
 	err := ss.ServerStream.RecvMsg(m)
 	if err == nil {
-		ss.m.msgRecv.with(ss.m.s, ss.typ, ss.method, noCode).Inc()
+		ss.m.msgRecv.with(ss.s, ss.typ, ss.method, noCode).Inc()
 	}
 	return err
 }
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime/debug"
 	"strings"
 	"testing"
 
@@ -14,9 +15,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestUnaryServerInterceptor(t *testing.T) {
@@ -33,7 +36,7 @@ func TestUnaryServerInterceptor(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	checkContains(t, m.s.Set,
+	checkContains(t, vmSet(m.s),
 		`grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
 		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 1`,
 		`grpc_server_msg_received_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
@@ -57,7 +60,7 @@ func TestStreamServerInterceptor(t *testing.T) {
 	}); err != nil {
 		t.Fatal(err)
 	}
-	checkContains(t, m.s.Set,
+	checkContains(t, vmSet(m.s),
 		`grpc_server_started_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
 		`grpc_server_handled_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch",grpc_code="OK"} 1`,
 		`grpc_server_msg_received_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
@@ -65,12 +68,90 @@ func TestStreamServerInterceptor(t *testing.T) {
 	)
 }
 
+func TestUnaryServerInterceptor_PanicRecovery(t *testing.T) {
+	m := newServerMetrics(
+		WithServerPanicRecovery(nil),
+	)
+	_, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(
+		context.Context, interface{},
+	) (interface{}, error) {
+		panic("boom")
+	})
+	if code := status.Code(err); code != codes.Internal {
+		t.Fatalf("code = %s, want %s", code, codes.Internal)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_panics_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="Internal"} 1`,
+	)
+}
+
+func TestStreamServerInterceptor_PanicsCounter(t *testing.T) {
+	m := newServerMetrics(
+		WithServerPanicsCounter(true),
+	)
+	defer func() {
+		// deferred functions of a panicking goroutine run on top of its stack
+		stack := string(debug.Stack())
+		if p := recover(); p != "boom" {
+			t.Fatalf("recover() = %v, want boom", p)
+		}
+		if !strings.Contains(stack, "panickingStreamHandler") {
+			t.Fatalf("handler's stack is lost:\n%s", stack)
+		}
+		checkContains(t, vmSet(m.s),
+			`grpc_server_panics_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch"} 1`,
+			`grpc_server_handled_total{grpc_type="server_stream",grpc_service="grpc.health.v1.Health",grpc_method="Watch",grpc_code="Internal"} 1`,
+		)
+	}()
+	_ = StreamServerInterceptor(m)(nil, &fakeServerStream{}, &grpc.StreamServerInfo{
+		FullMethod:     "/grpc.health.v1.Health/Watch",
+		IsServerStream: true,
+	}, panickingStreamHandler)
+	t.Fatal("panic is not re-raised")
+}
+
+func panickingStreamHandler(interface{}, grpc.ServerStream) error {
+	panic("boom")
+}
+
+func TestUnaryServerInterceptor_Termination(t *testing.T) {
+	m := newServerMetrics(
+		WithServerTerminationLabel(true),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range []error{
+		status.Error(codes.Canceled, "canceled by handler"),
+		context.Canceled,
+	} {
+		_, _ = UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+	if _, err := UnaryServerInterceptor(m)(ctx, nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return nil, ctx.Err()
+	}); err != context.Canceled {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="Canceled",grpc_termination="completed"} 2`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="Canceled",grpc_termination="canceled"} 1`,
+	)
+}
+
 func TestServerMetrics_InitializeMetrics(t *testing.T) {
 	m := newServerMetrics(
 		WithServerHandlingTimeHistogram(true),
 	)
 	m.InitializeMetrics(newServer())
-	checkContains(t, m.s.Set,
+	checkContains(t, vmSet(m.s),
 		`grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
 		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 0`,
 		`grpc_server_msg_received_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0`,
@@ -83,7 +164,7 @@ func TestServerMetrics_InitializeMetrics(t *testing.T) {
 }
 
 func BenchmarkScrapeServer_metrics(b *testing.B) {
-	benchScrape(b, newServerMetrics().s)
+	benchScrape(b, vmSet(newServerMetrics().s))
 }
 
 func BenchmarkScrapeServer_client_golang(b *testing.B) {
@@ -168,6 +249,10 @@ func benchStreamServerInterceptor(b *testing.B, h grpc.StreamServerInterceptor)
 	})
 }
 
+func vmSet(b Backend) *metrics.Set {
+	return b.(*vmBackend).s
+}
+
 func checkContains(t *testing.T, s *metrics.Set, what ...string) {
 	t.Helper()
 	var b bytes.Buffer
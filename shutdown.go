@@ -0,0 +1,150 @@
+package grpcmetrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var streamTypes = [...]string{unary, "client_stream", "server_stream", "bidi_stream"}
+
+// Server is a grpc.Server whose graceful shutdown is measured, see WrapServer.
+type Server struct {
+	*grpc.Server
+	m *ServerMetrics
+	d *drain
+}
+
+// OpenStream is a stream that hasn't finished in time during shutdown.
+type OpenStream struct {
+	Type       string
+	FullMethod string
+	StartedAt  time.Time
+}
+
+// WrapServer starts tracking in-flight calls of s, so its shutdown records:
+//
+//   - grpc_server_shutdown_inflight_at_start, calls in flight when it starts
+//   - grpc_server_shutdown_drain_seconds, how long draining takes
+//   - grpc_server_shutdown_arrived_total, calls started while draining
+//
+// It must be called before s starts serving and only once.
+func (m *ServerMetrics) WrapServer(s *grpc.Server) *Server {
+	d := &drain{
+		arrived:  newCounter("grpc_server_shutdown_arrived_total"),
+		duration: m.s.Histogram("grpc_server_shutdown_drain_seconds", nil),
+		created:  time.Now(),
+		streams:  map[*OpenStream]struct{}{},
+	}
+	for i, typ := range streamTypes {
+		i := i
+		m.s.Gauge("grpc_server_shutdown_inflight_at_start", []Label{{"grpc_type", typ}}, func() float64 {
+			return float64(atomic.LoadInt64(&d.atStart[i]))
+		})
+	}
+	m.drain = d
+	return &Server{Server: s, m: m, d: d}
+}
+
+// GracefulStop is grpc.Server.GracefulStop that records shutdown metrics.
+func (s *Server) GracefulStop() {
+	startedAt := s.d.begin()
+	s.Server.GracefulStop()
+	s.d.duration.UpdateDuration(startedAt)
+}
+
+// GracefulStopTimeout is like GracefulStop but when calls don't finish within
+// timeout, it returns streams that are still open and stops the server forcibly.
+func (s *Server) GracefulStopTimeout(timeout time.Duration) []OpenStream {
+	startedAt := s.d.begin()
+	done := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(done)
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	var open []OpenStream
+	select {
+	case <-done:
+	case <-t.C:
+		open = s.d.openStreams()
+		s.Server.Stop()
+		<-done
+	}
+	s.d.duration.UpdateDuration(startedAt)
+	return open
+}
+
+type drain struct {
+	inflight [len(streamTypes)]int64
+	atStart  [len(streamTypes)]int64
+	draining int32
+	arrived  *counter
+	duration Histogram
+	created  time.Time
+
+	mu      sync.Mutex
+	streams map[*OpenStream]struct{}
+}
+
+func (d *drain) begin() time.Time {
+	atomic.StoreInt32(&d.draining, 1)
+	for i := range d.inflight {
+		atomic.StoreInt64(&d.atStart[i], atomic.LoadInt64(&d.inflight[i]))
+	}
+	return time.Now()
+}
+
+// start accounts a call, the returned stream is nil for unary calls,
+// since they're not listed when the timeout is hit.
+func (d *drain) start(b Backend, typ, method string) *OpenStream {
+	atomic.AddInt64(&d.inflight[typeIndex(typ)], 1)
+	if atomic.LoadInt32(&d.draining) == 1 {
+		d.arrived.with(b, typ, method, noCode).Inc()
+	}
+	if typ == unary {
+		return nil
+	}
+	s := &OpenStream{Type: typ, FullMethod: method, StartedAt: time.Now()}
+	d.mu.Lock()
+	d.streams[s] = struct{}{}
+	d.mu.Unlock()
+	return s
+}
+
+func (d *drain) finish(typ string, s *OpenStream) {
+	atomic.AddInt64(&d.inflight[typeIndex(typ)], -1)
+	if s != nil {
+		d.mu.Lock()
+		delete(d.streams, s)
+		d.mu.Unlock()
+	}
+}
+
+// openStreams returns open streams, the oldest ones first.
+func (d *drain) openStreams() []OpenStream {
+	d.mu.Lock()
+	list := make([]OpenStream, 0, len(d.streams))
+	for s := range d.streams {
+		list = append(list, *s)
+	}
+	d.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	return list
+}
+
+func typeIndex(typ string) int {
+	for i := range streamTypes {
+		if streamTypes[i] == typ {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package grpcmetrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServer_GracefulStopTimeout(t *testing.T) {
+	m := newServerMetrics()
+	lis := bufconn.Listen(1 << 20)
+	s := m.WrapServer(grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(m)),
+		grpc.StreamInterceptor(StreamServerInterceptor(m)),
+	))
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	// watch streams never finish on their own
+	stream, err := grpc_health_v1.NewHealthClient(cc).Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	open := s.GracefulStopTimeout(50 * time.Millisecond)
+	if len(open) != 1 || open[0].FullMethod != "/grpc.health.v1.Health/Watch" || open[0].Type != "server_stream" {
+		t.Fatalf("open streams = %+v", open)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_shutdown_inflight_at_start{grpc_type="server_stream"} 1`,
+		`grpc_server_shutdown_inflight_at_start{grpc_type="unary"} 0`,
+		`grpc_server_shutdown_drain_seconds_count 1`,
+	)
+}
+
+func TestServer_arrivedWhileDraining(t *testing.T) {
+	m := newServerMetrics()
+	s := m.WrapServer(grpc.NewServer())
+	s.d.begin()
+	if _, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_shutdown_arrived_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+	)
+	if n := s.d.inflight[0]; n != 0 {
+		t.Fatalf("in-flight unary calls = %d, want 0", n)
+	}
+	checkExposed(t, m,
+		"grpc_server_shutdown_inflight_at_start",
+		"grpc_server_shutdown_drain_seconds",
+		"grpc_server_shutdown_arrived",
+	)
+}
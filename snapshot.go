@@ -0,0 +1,268 @@
+package grpcmetrics
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+)
+
+// MethodStats is a point-in-time view of a single method's series.
+type MethodStats struct {
+	Type        string
+	Service     string
+	Method      string
+	Started     uint64
+	Handled     map[codes.Code]uint64
+	MsgSent     uint64
+	MsgReceived uint64
+	Panics      uint64
+
+	// Handling is nil when the handling time histogram has never been enabled,
+	// series disabled by Update are reported as they were last updated.
+	Handling *HistogramStats
+
+	// TopCallers of the last refresh interval, see WithServerTopCallers.
+	TopCallers []CallerStats
+}
+
+func (s *MethodStats) FullMethod() string {
+	return "/" + s.Service + "/" + s.Method
+}
+
+func (s *MethodStats) HandledTotal() uint64 {
+	var n uint64
+	for _, v := range s.Handled {
+		n += v
+	}
+	return n
+}
+
+// Errors returns the number of handled calls with non-OK codes.
+func (s *MethodStats) Errors() uint64 {
+	return s.HandledTotal() - s.Handled[codes.OK]
+}
+
+// InFlight returns the number of started but not yet handled calls.
+func (s *MethodStats) InFlight() uint64 {
+	if n := s.HandledTotal(); n < s.Started {
+		return s.Started - n
+	}
+	return 0
+}
+
+// HistogramStats contains non-empty buckets of a histogram ordered by their bounds.
+type HistogramStats struct {
+	Count   uint64
+	Buckets []BucketStats
+
+	// Sum is zero when the source doesn't provide it.
+	Sum float64
+}
+
+// BucketStats is a histogram bucket, Lower is exclusive and Upper is inclusive.
+type BucketStats struct {
+	Lower, Upper float64
+	Count        uint64
+}
+
+// Quantile estimates the q-th quantile, 0 <= q <= 1, by linear
+// interpolation inside the bucket it falls into, NaN is returned
+// for empty histograms.
+func (h *HistogramStats) Quantile(q float64) float64 {
+	if h == nil || h.Count == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(h.Count)
+	var seen uint64
+	for _, b := range h.Buckets {
+		if float64(seen+b.Count) >= rank {
+			if math.IsInf(b.Upper, 1) {
+				return b.Lower
+			}
+			return b.Lower + (b.Upper-b.Lower)*(rank-float64(seen))/float64(b.Count)
+		}
+		seen += b.Count
+	}
+	return h.Buckets[len(h.Buckets)-1].Upper
+}
+
+// leBounds are le bounds of histograms exposed in the classic form, they're
+// the same for all series so that buckets can be aggregated across them
+// and match prometheus.DefBuckets.
+var leBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// cumulative returns cumulative counts for each of leBounds, every bucket
+// is accounted to the smallest bound not below its upper bound, so counts
+// never include observations above their bounds.
+func (h *HistogramStats) cumulative() []uint64 {
+	counts := make([]uint64, len(leBounds))
+	for _, b := range h.Buckets {
+		i := sort.SearchFloat64s(leBounds, b.Upper)
+		if i < len(counts) {
+			counts[i] += b.Count
+		}
+	}
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+	return counts
+}
+
+func (h *HistogramStats) sub(prev *HistogramStats) *HistogramStats {
+	if prev == nil {
+		return h
+	}
+	d := &HistogramStats{Sum: math.Max(h.Sum-prev.Sum, 0)}
+	j := 0
+	for _, b := range h.Buckets {
+		for j < len(prev.Buckets) && prev.Buckets[j].Upper < b.Upper {
+			j++
+		}
+		if j < len(prev.Buckets) && prev.Buckets[j].Upper == b.Upper {
+			b.Count = sub(b.Count, prev.Buckets[j].Count)
+		}
+		if b.Count != 0 {
+			d.Count += b.Count
+			d.Buckets = append(d.Buckets, b)
+		}
+	}
+	return d
+}
+
+// Merge returns the sum of two histograms, that's needed when
+// a method has multiple series with different labels.
+func (h *HistogramStats) Merge(other *HistogramStats) *HistogramStats {
+	if h == nil {
+		return other
+	}
+	m := &HistogramStats{Count: h.Count + other.Count, Sum: h.Sum + other.Sum}
+	i, j := 0, 0
+	for i < len(h.Buckets) || j < len(other.Buckets) {
+		switch {
+		case j == len(other.Buckets) || i < len(h.Buckets) && h.Buckets[i].Upper < other.Buckets[j].Upper:
+			m.Buckets = append(m.Buckets, h.Buckets[i])
+			i++
+		case i == len(h.Buckets) || other.Buckets[j].Upper < h.Buckets[i].Upper:
+			m.Buckets = append(m.Buckets, other.Buckets[j])
+			j++
+		default:
+			b := h.Buckets[i]
+			b.Count += other.Buckets[j].Count
+			m.Buckets = append(m.Buckets, b)
+			i++
+			j++
+		}
+	}
+	return m
+}
+
+func (m *ServerMetrics) Snapshot() []MethodStats {
+	handling, panics := m.exported()
+	list := snapshot(m.started, m.handled, m.msgSent, m.msgRecv, panics, handling)
+	for i := range list {
+		list[i].TopCallers = m.hitters.get(list[i].FullMethod())
+	}
+	return list
+}
+
+func (m *ClientMetrics) Snapshot() []MethodStats {
+	return snapshot(m.started, m.handled, m.msgSent, m.msgRecv, nil, m.exported())
+}
+
+// DiffSnapshots returns per-method deltas between two snapshots,
+// methods missing in prev are returned as they are in cur.
+// Counters that went backwards are treated as reset to zero.
+func DiffSnapshots(prev, cur []MethodStats) []MethodStats {
+	idx := make(map[string]*MethodStats, len(prev))
+	for i := range prev {
+		idx[prev[i].FullMethod()] = &prev[i]
+	}
+	diff := make([]MethodStats, 0, len(cur))
+	for _, c := range cur {
+		p, ok := idx[c.FullMethod()]
+		if !ok {
+			diff = append(diff, c)
+			continue
+		}
+		d := MethodStats{
+			Type:        c.Type,
+			Service:     c.Service,
+			Method:      c.Method,
+			Started:     sub(c.Started, p.Started),
+			Handled:     make(map[codes.Code]uint64, len(c.Handled)),
+			MsgSent:     sub(c.MsgSent, p.MsgSent),
+			MsgReceived: sub(c.MsgReceived, p.MsgReceived),
+			Panics:      sub(c.Panics, p.Panics),
+			TopCallers:  c.TopCallers,
+		}
+		for code, n := range c.Handled {
+			d.Handled[code] = sub(n, p.Handled[code])
+		}
+		if c.Handling != nil {
+			d.Handling = c.Handling.sub(p.Handling)
+		}
+		diff = append(diff, d)
+	}
+	return diff
+}
+
+func sub(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return a - b
+}
+
+func snapshot(started, handled, msgSent, msgRecv, panics *counter, handling *histogram) []MethodStats {
+	stats := map[string]*MethodStats{}
+	// methods are keyed by sanitized names, so series shared
+	// by colliding methods are accounted to the same method
+	get := func(typ, method string) *MethodStats {
+		service, name := splitMethodName(method)
+		service, name = validUTF8(service), validUTF8(name)
+		key := service + "/" + name
+		s, ok := stats[key]
+		if !ok {
+			s = &MethodStats{
+				Type:    typ,
+				Service: service,
+				Method:  name,
+				Handled: map[codes.Code]uint64{},
+			}
+			stats[key] = s
+		}
+		return s
+	}
+	add := func(c *counter, fn func(s *MethodStats, key seriesKey, n uint64)) {
+		if c == nil {
+			return
+		}
+		c.visit(func(typ, method string, key seriesKey, v any) {
+			fn(get(typ, method), key, v.(Counter).Get())
+		})
+	}
+	add(started, func(s *MethodStats, _ seriesKey, n uint64) { s.Started += n })
+	add(handled, func(s *MethodStats, key seriesKey, n uint64) { s.Handled[key.code] += n })
+	add(msgSent, func(s *MethodStats, _ seriesKey, n uint64) { s.MsgSent += n })
+	add(msgRecv, func(s *MethodStats, _ seriesKey, n uint64) { s.MsgReceived += n })
+	add(panics, func(s *MethodStats, _ seriesKey, n uint64) { s.Panics += n })
+	if handling != nil {
+		handling.visit(func(typ, method string, _ seriesKey, v any) {
+			s := get(typ, method)
+			s.Handling = s.Handling.Merge(v.(Histogram).Stats())
+		})
+	}
+
+	list := make([]MethodStats, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Service != list[j].Service {
+			return list[i].Service < list[j].Service
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
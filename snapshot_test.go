@@ -0,0 +1,91 @@
+package grpcmetrics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerMetrics_Snapshot(t *testing.T) {
+	m := newServerMetrics(
+		WithServerHandlingTimeHistogram(true),
+	)
+	m.InitializeMetrics(newServer())
+	call := func(err error) {
+		_, _ = UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+	call(nil)
+	prev := m.Snapshot()
+	call(nil)
+	call(status.Error(codes.NotFound, "not found"))
+
+	cur := m.Snapshot()
+	if len(cur) != 2 {
+		t.Fatalf("len(snapshot) = %d, want 2", len(cur))
+	}
+	s := cur[0]
+	if s.FullMethod() != "/grpc.health.v1.Health/Check" || s.Type != unary {
+		t.Fatalf("unexpected method %s of type %s", s.FullMethod(), s.Type)
+	}
+	if s.Started != 3 || s.Handled[codes.OK] != 2 || s.Handled[codes.NotFound] != 1 ||
+		s.MsgReceived != 3 || s.MsgSent != 2 || s.Handling.Count != 3 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if q := s.Handling.Quantile(0.5); q <= 0 {
+		t.Fatalf("p50 = %f, want > 0", q)
+	}
+
+	d := DiffSnapshots(prev, cur)[0]
+	if d.Started != 2 || d.Handled[codes.OK] != 1 || d.Errors() != 1 || d.Handling.Count != 2 {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+}
+
+func TestHistogramStats_Quantile(t *testing.T) {
+	h := &HistogramStats{
+		Count: 4,
+		Buckets: []BucketStats{
+			{0, 1, 2},
+			{1, 2, 2},
+		},
+	}
+	for q, want := range map[float64]float64{
+		0.25: 0.5,
+		0.5:  1,
+		1:    2,
+	} {
+		if got := h.Quantile(q); got != want {
+			t.Errorf("Quantile(%f) = %f, want %f", q, got, want)
+		}
+	}
+}
+
+func TestHistogramStats_merge(t *testing.T) {
+	a := &HistogramStats{Count: 3, Buckets: []BucketStats{{0, 1, 1}, {2, 3, 2}}}
+	b := &HistogramStats{Count: 2, Buckets: []BucketStats{{1, 2, 1}, {2, 3, 1}}}
+	m := a.Merge(b)
+	if m.Count != 5 || len(m.Buckets) != 3 || m.Buckets[1].Count != 1 || m.Buckets[2].Count != 3 {
+		t.Fatalf("unexpected merge result: %+v", m)
+	}
+}
+
+func TestHistogramStats_cumulative(t *testing.T) {
+	h := &HistogramStats{Count: 4, Buckets: []BucketStats{
+		{Lower: 0.0046, Upper: 0.0052, Count: 1},
+		{Lower: 0.0052, Upper: 0.0059, Count: 1},
+		{Lower: 0.9, Upper: 1, Count: 1},
+		{Lower: 12, Upper: 13, Count: 1},
+	}}
+	want := []uint64{0, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3}
+	if got := h.cumulative(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("cumulative = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,360 @@
+// Package statsd sends series recorded by grpcmetrics interceptors
+// as StatsD or DogStatsD packets:
+//
+//	e, err := statsd.New("udp", "127.0.0.1:8125")
+//	if err != nil {
+//		return err
+//	}
+//	defer e.Close()
+//	m := grpcmetrics.NewServerMetrics(grpcmetrics.WithServerBackend(e))
+//
+// Calls are aggregated in-process, counters are sent as deltas and
+// durations are sampled, then lines are batched into packets every
+// flush interval, so there's no packet per call.
+package statsd
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/amenzhinsky/grpcmetrics"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	defaultPacketSize    = 1432 // fits into ethernet MTU
+	defaultMaxSamples    = 128
+)
+
+type Option func(e *Emitter)
+
+// WithPrefix prepends prefix to metric names, e.g. "myapp.".
+func WithPrefix(prefix string) Option {
+	return func(e *Emitter) {
+		e.prefix = prefix
+	}
+}
+
+func WithFlushInterval(d time.Duration) Option {
+	return func(e *Emitter) {
+		e.interval = d
+	}
+}
+
+// WithPacketSize sets the maximum packet size, lines are never split,
+// so longer lines are sent in their own packets.
+func WithPacketSize(n int) Option {
+	return func(e *Emitter) {
+		e.packetSize = n
+	}
+}
+
+// WithMaxSamples limits the number of durations sent per series every flush,
+// the rest is accounted by the sample rate.
+func WithMaxSamples(n int) Option {
+	return func(e *Emitter) {
+		e.maxSamples = n
+	}
+}
+
+// WithPlainStatsD disables DogStatsD tags, label values are appended to metric
+// names instead, e.g. grpc_server_started_total.unary.grpc_health_v1_Health.Check.
+func WithPlainStatsD() Option {
+	return func(e *Emitter) {
+		e.plain = true
+	}
+}
+
+// WithErrorHandler is called on write errors, they're ignored by default.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(e *Emitter) {
+		e.onError = fn
+	}
+}
+
+// Emitter is a grpcmetrics.Backend that sends series to a StatsD agent,
+// values are also kept in-process, so snapshots keep working.
+type Emitter struct {
+	conn       net.Conn
+	prefix     string
+	interval   time.Duration
+	packetSize int
+	maxSamples int
+	plain      bool
+	onError    func(err error)
+
+	local grpcmetrics.Backend
+
+	mu     sync.Mutex
+	series map[string]*series
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+type series struct {
+	name, tags string
+	v          interface{}
+}
+
+// New connects to the agent, network is either "udp" or "unixgram".
+func New(network, addr string, opts ...Option) (*Emitter, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	e := &Emitter{
+		conn:       conn,
+		interval:   defaultFlushInterval,
+		packetSize: defaultPacketSize,
+		maxSamples: defaultMaxSamples,
+		local:      grpcmetrics.VictoriaMetricsBackend(metrics.NewSet()),
+		series:     map[string]*series{},
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e, nil
+}
+
+func (e *Emitter) run() {
+	defer e.wg.Done()
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			e.Flush()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// Close flushes pending values and closes the connection.
+func (e *Emitter) Close() error {
+	var err error
+	e.once.Do(func() {
+		close(e.done)
+		e.wg.Wait()
+		e.Flush()
+		err = e.conn.Close()
+	})
+	return err
+}
+
+func (e *Emitter) Counter(name string, labels []grpcmetrics.Label) grpcmetrics.Counter {
+	return e.getOrCreate(name, labels, func() interface{} {
+		return &counter{Counter: e.local.Counter(name, labels)}
+	}).(*counter)
+}
+
+func (e *Emitter) Histogram(name string, labels []grpcmetrics.Label) grpcmetrics.Histogram {
+	return e.getOrCreate(name, labels, func() interface{} {
+		return &histogram{
+			Histogram: e.local.Histogram(name, labels),
+			samples:   make([]float64, 0, e.maxSamples),
+		}
+	}).(*histogram)
+}
+
+func (e *Emitter) Gauge(name string, labels []grpcmetrics.Label, f func() float64) {
+	e.getOrCreate(name, labels, func() interface{} {
+		return f
+	})
+}
+
+// Unregister drops the series, values recorded since the last flush are lost.
+func (e *Emitter) Unregister(name string, labels []grpcmetrics.Label) {
+	n, tags := e.render(name, labels)
+	e.mu.Lock()
+	delete(e.series, n+tags)
+	e.mu.Unlock()
+	e.local.Unregister(name, labels)
+}
+
+func (e *Emitter) getOrCreate(name string, labels []grpcmetrics.Label, new func() interface{}) interface{} {
+	name, tags := e.render(name, labels)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if sr, ok := e.series[name+tags]; ok {
+		return sr.v
+	}
+	sr := &series{name: name, tags: tags, v: new()}
+	e.series[name+tags] = sr
+	return sr.v
+}
+
+// render returns the metric name and DogStatsD tags of a series,
+// tags start with "|#" unless they're empty.
+func (e *Emitter) render(name string, labels []grpcmetrics.Label) (string, string) {
+	name = e.prefix + name
+	if e.plain {
+		for _, l := range labels {
+			name += "." + sanitize(l.Value, "|:.\n#, ")
+		}
+		return name, ""
+	}
+	var b strings.Builder
+	for i, l := range labels {
+		if i == 0 {
+			b.WriteString("|#")
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(strings.TrimPrefix(l.Name, "grpc_"))
+		b.WriteByte(':')
+		b.WriteString(sanitize(l.Value, "|,\n#"))
+	}
+	return name, b.String()
+}
+
+// sanitize replaces characters that break the line format with underscores.
+func sanitize(s, chars string) string {
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(chars, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// Flush sends values aggregated since the last flush,
+// it's called periodically, calling it directly is rarely needed.
+func (e *Emitter) Flush() {
+	e.mu.Lock()
+	list := make([]*series, 0, len(e.series))
+	for _, sr := range e.series {
+		list = append(list, sr)
+	}
+	e.mu.Unlock()
+
+	p := packer{e: e}
+	for _, sr := range list {
+		switch v := sr.v.(type) {
+		case *counter:
+			if n := v.delta(); n != 0 {
+				p.add(line(sr, strconv.FormatUint(n, 10), "c", 1))
+			}
+		case *histogram:
+			samples, rate := v.drain()
+			for _, s := range samples {
+				p.add(line(sr, strconv.FormatFloat(s*1000, 'f', -1, 64), "ms", rate))
+			}
+		case func() float64:
+			// e.g. error ratios of windows without calls are NaN
+			if f := v(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+				p.add(line(sr, strconv.FormatFloat(f, 'f', -1, 64), "g", 1))
+			}
+		}
+	}
+	p.flush()
+}
+
+func line(sr *series, value, typ string, rate float64) string {
+	s := sr.name + ":" + value + "|" + typ
+	if rate < 1 {
+		s += "|@" + strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+	return s + sr.tags
+}
+
+// packer batches lines into packets of at most packetSize bytes.
+type packer struct {
+	e   *Emitter
+	buf bytes.Buffer
+}
+
+func (p *packer) add(line string) {
+	if p.buf.Len() != 0 && p.buf.Len()+1+len(line) > p.e.packetSize {
+		p.flush()
+	}
+	if p.buf.Len() != 0 {
+		p.buf.WriteByte('\n')
+	}
+	p.buf.WriteString(line)
+}
+
+func (p *packer) flush() {
+	if p.buf.Len() == 0 {
+		return
+	}
+	if _, err := p.e.conn.Write(p.buf.Bytes()); err != nil && p.e.onError != nil {
+		p.e.onError(err)
+	}
+	p.buf.Reset()
+}
+
+type counter struct {
+	grpcmetrics.Counter
+
+	mu      sync.Mutex
+	flushed uint64
+}
+
+// delta returns the increase since the previous call.
+func (c *counter) delta() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.Get()
+	d := n - c.flushed
+	c.flushed = n
+	return d
+}
+
+type histogram struct {
+	grpcmetrics.Histogram
+
+	mu      sync.Mutex
+	samples []float64
+	n       int
+}
+
+func (h *histogram) Update(v float64) {
+	h.Histogram.Update(v)
+	h.sample(v)
+}
+
+func (h *histogram) UpdateDuration(startTime time.Time) {
+	h.Update(time.Since(startTime).Seconds())
+}
+
+// sample keeps a uniform sample of values observed since the last flush.
+func (h *histogram) sample(v float64) {
+	h.mu.Lock()
+	h.n++
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, v)
+	} else if i := rand.Intn(h.n); i < len(h.samples) {
+		h.samples[i] = v
+	}
+	h.mu.Unlock()
+}
+
+// drain returns sampled values and the sample rate.
+func (h *histogram) drain() ([]float64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.n == 0 {
+		return nil, 1
+	}
+	samples := append([]float64(nil), h.samples...)
+	rate := float64(len(samples)) / float64(h.n)
+	h.samples = h.samples[:0]
+	h.n = 0
+	return samples, rate
+}
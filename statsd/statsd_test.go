@@ -0,0 +1,177 @@
+package statsd
+
+import (
+	"context"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEmitter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := New("udp", conn.LocalAddr().String(), WithPrefix("app."), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	m := grpcmetrics.NewServerMetrics(
+		grpcmetrics.WithServerBackend(e),
+		grpcmetrics.WithServerHandlingTimeHistogram(true),
+	)
+	for _, err := range []error{nil, nil, status.Error(codes.NotFound, "")} {
+		_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+	e.Flush()
+
+	lines := readLines(t, conn)
+	for _, want := range []string{
+		"app.grpc_server_started_total:3|c|#type:unary,service:grpc.health.v1.Health,method:Check",
+		"app.grpc_server_handled_total:2|c|#type:unary,service:grpc.health.v1.Health,method:Check,code:OK",
+		"app.grpc_server_handled_total:1|c|#type:unary,service:grpc.health.v1.Health,method:Check,code:NotFound",
+	} {
+		if !contains(lines, want) {
+			t.Errorf("%q not found in:\n%s", want, strings.Join(lines, "\n"))
+		}
+	}
+	var timings int
+	for _, l := range lines {
+		if strings.HasPrefix(l, "app.grpc_server_handling_seconds:") && strings.Contains(l, "|ms|#") {
+			timings++
+		}
+	}
+	if timings != 3 {
+		t.Errorf("got %d timings, want 3", timings)
+	}
+
+	// counters are sent as deltas, so unchanged ones are skipped
+	_, _ = grpcmetrics.UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+		FullMethod: "/grpc.health.v1.Health/Check",
+	}, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	e.Flush()
+	lines = readLines(t, conn)
+	if !contains(lines, "app.grpc_server_started_total:1|c|#type:unary,service:grpc.health.v1.Health,method:Check") ||
+		contains(lines, "app.grpc_server_handled_total:0|c|#type:unary,service:grpc.health.v1.Health,method:Check,code:NotFound") {
+		t.Errorf("unexpected lines:\n%s", strings.Join(lines, "\n"))
+	}
+
+	// values are kept in-process as well
+	if s := m.Snapshot(); len(s) != 1 || s[0].Started != 4 {
+		t.Errorf("unexpected snapshot: %+v", s)
+	}
+}
+
+func TestEmitter_batching(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := New("udp", conn.LocalAddr().String(),
+		WithPlainStatsD(), WithPacketSize(100), WithMaxSamples(2), WithFlushInterval(time.Hour),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	h := e.Histogram("latency", []grpcmetrics.Label{{Name: "grpc_service", Value: "a.B"}})
+	for i := 0; i < 10; i++ {
+		h.Update(0.5)
+	}
+	for i := 0; i < 5; i++ {
+		e.Counter("calls", []grpcmetrics.Label{{Name: "grpc_method", Value: string(rune('a' + i))}}).Inc()
+	}
+	e.Flush()
+
+	var packets int
+	var lines []string
+	buf := make([]byte, 1024)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > 100 {
+			t.Errorf("packet size = %d, want <= 100", n)
+		}
+		packets++
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	sort.Strings(lines)
+	if want := []string{
+		"calls.a:1|c", "calls.b:1|c", "calls.c:1|c", "calls.d:1|c", "calls.e:1|c",
+		"latency.a_B:500|ms|@0.2", "latency.a_B:500|ms|@0.2",
+	}; strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if packets < 2 {
+		t.Errorf("packets = %d, want more than one", packets)
+	}
+}
+
+func TestEmitter_nonFiniteGauges(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := New("udp", conn.LocalAddr().String(), WithPlainStatsD(), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	e.Gauge("ratio", nil, math.NaN)
+	e.Gauge("inf", nil, func() float64 { return math.Inf(1) })
+	e.Gauge("rate", nil, func() float64 { return 0.5 })
+	e.Flush()
+	if lines := readLines(t, conn); strings.Join(lines, "\n") != "rate:0.5|g" {
+		t.Errorf("lines = %q, want only the finite gauge", lines)
+	}
+}
+
+func readLines(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return lines
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package grpcmetrics
+
+import (
+	"context"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// WithServerTenantSets records series of every call into a metrics.Set
+// of the tenant that key returns for the call's context, sets are created
+// on the first call of a tenant. Once max sets exist, calls of new tenants
+// as well as calls with empty keys are recorded into the default set.
+//
+// InitializeMetrics pre-populates only the default set and
+// Snapshot sums series of all sets. Tenant sets are VictoriaMetrics
+// sets, so NewServerMetrics panics when another backend is used.
+func WithServerTenantSets(key func(ctx context.Context) string, max int) ServerOption {
+	return func(m *ServerMetrics) {
+		m.mustNotUpdate("WithServerTenantSets")
+		m.tenants = &tenantSets{
+			key:  key,
+			max:  max,
+			sets: map[string]Backend{},
+		}
+	}
+}
+
+// TenantSet returns the set of the named tenant to expose it
+// via its own endpoint, it's nil until the tenant makes a call.
+func (m *ServerMetrics) TenantSet(key string) *metrics.Set {
+	if m.tenants == nil {
+		return nil
+	}
+	m.tenants.mu.RLock()
+	defer m.tenants.mu.RUnlock()
+	if s, ok := m.tenants.sets[key]; ok {
+		return s.(*vmBackend).s
+	}
+	return nil
+}
+
+// set returns the set for series of the call that ctx belongs to.
+func (m *ServerMetrics) set(ctx context.Context) Backend {
+	if m.tenants == nil {
+		return m.s
+	}
+	if s := m.tenants.get(m.tenants.key(ctx)); s != nil {
+		return s
+	}
+	return m.s
+}
+
+type tenantSets struct {
+	key  func(ctx context.Context) string
+	max  int
+	mu   sync.RWMutex
+	sets map[string]Backend
+}
+
+// get returns the tenant's set, creating it if the limit allows,
+// nil is returned otherwise.
+func (t *tenantSets) get(key string) Backend {
+	if key == "" {
+		return nil
+	}
+	t.mu.RLock()
+	s, ok := t.sets[key]
+	t.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok = t.sets[key]; ok {
+		return s
+	}
+	if len(t.sets) >= t.max {
+		return nil
+	}
+	s = &vmBackend{metrics.NewSet()}
+	t.sets[key] = s
+	return s
+}
@@ -0,0 +1,65 @@
+package grpcmetrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+type tenantKey struct{}
+
+func TestWithServerTenantSets(t *testing.T) {
+	m := newServerMetrics(
+		WithServerTenantSets(func(ctx context.Context) string {
+			s, _ := ctx.Value(tenantKey{}).(string)
+			return s
+		}, 2),
+	)
+	for _, tenant := range []string{"a", "b", "a", "c", ""} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		if _, err := UnaryServerInterceptor(m)(ctx, nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkContains(t, m.TenantSet("a"),
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 2`,
+	)
+	checkContains(t, m.TenantSet("b"),
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 1`,
+	)
+	if m.TenantSet("c") != nil {
+		t.Fatal("tenant set is created over the limit")
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 2`,
+	)
+
+	var b bytes.Buffer
+	m.TenantSet("b").WritePrometheus(&b)
+	if strings.Contains(b.String(), " 2\n") {
+		t.Fatalf("tenant set contains series of other tenants:\n%s", b.String())
+	}
+	if s := m.Snapshot(); len(s) != 1 || s[0].Started != 5 {
+		t.Fatalf("unexpected snapshot: %+v", s)
+	}
+}
+
+func TestWithServerTenantSets_backend(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("tenant sets are accepted with a non-VictoriaMetrics backend")
+		}
+	}()
+	NewServerMetrics(
+		WithServerBackend(struct{ Backend }{VictoriaMetricsBackend(nil)}),
+		WithServerTenantSets(func(context.Context) string { return "" }, 1),
+	)
+}
@@ -0,0 +1,117 @@
+package grpcmetrics
+
+import "fmt"
+
+// Update applies options to metrics that are already in use, settings
+// not changed by opts are kept. Series recorded so far aren't lost,
+// disabled ones stay exported by all exporters and in Snapshot
+// but aren't updated until enabled again.
+//
+// Options that change the set, custom labels, tenants or series TTL
+// can only be passed to NewServerMetrics, Update panics on them.
+func (m *ServerMetrics) Update(opts ...ServerOption) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apply(true, opts)
+}
+
+// Update is the client version of (*ServerMetrics).Update.
+func (m *ClientMetrics) Update(opts ...ClientOption) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apply(true, opts)
+}
+
+// apply builds a new config from the current one and opts and
+// makes it visible to calls started afterwards all at once.
+func (m *ServerMetrics) apply(updating bool, opts []ServerOption) {
+	next := *m.config()
+	m.next, m.updating = &next, updating
+	for _, opt := range opts {
+		opt(m)
+	}
+	if next.windows != nil && next.windows.s == nil {
+		next.windows.s = m.s
+	}
+	m.cfg.Store(m.next)
+	m.next, m.updating = nil, false
+}
+
+func (m *ClientMetrics) apply(updating bool, opts []ClientOption) {
+	next := *m.config()
+	m.next, m.updating = &next, updating
+	for _, opt := range opts {
+		opt(m)
+	}
+	if next.windows != nil && next.windows.s == nil {
+		next.windows.s = m.s
+	}
+	m.cfg.Store(m.next)
+	m.next, m.updating = nil, false
+}
+
+// exported returns optional metrics including the ones disabled by Update,
+// they stay exported so all exporters report the same series.
+func (m *ServerMetrics) exported() (*histogram, *counter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.handling, m.panics
+}
+
+func (m *ClientMetrics) exported() *histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.handling
+}
+
+func (m *ServerMetrics) mustNotUpdate(option string) {
+	if m.updating {
+		panic(fmt.Sprintf("%s cannot be changed by Update", option))
+	}
+}
+
+func (m *ClientMetrics) mustNotUpdate(option string) {
+	if m.updating {
+		panic(fmt.Sprintf("%s cannot be changed by Update", option))
+	}
+}
+
+// ServerSettings reports which of the settings changeable by Update are enabled.
+type ServerSettings struct {
+	HandlingTimeHistogram bool `json:"handling_time_histogram"`
+	PanicsCounter         bool `json:"panics_counter"`
+	PanicRecovery         bool `json:"panic_recovery"`
+	TerminationLabel      bool `json:"termination_label"`
+	WindowStats           bool `json:"window_stats"`
+	WindowGauges          bool `json:"window_gauges"`
+}
+
+func (m *ServerMetrics) Settings() ServerSettings {
+	c := m.config()
+	return ServerSettings{
+		HandlingTimeHistogram: c.handling != nil,
+		PanicsCounter:         c.panics != nil,
+		PanicRecovery:         c.recoverPanic != nil,
+		TerminationLabel:      c.termination,
+		WindowStats:           c.windows != nil,
+		WindowGauges:          c.windows.gaugesEnabled(),
+	}
+}
+
+// ClientSettings reports which of the settings changeable by Update are enabled.
+type ClientSettings struct {
+	HandlingTimeHistogram bool `json:"handling_time_histogram"`
+	TerminationLabel      bool `json:"termination_label"`
+	WindowStats           bool `json:"window_stats"`
+	WindowGauges          bool `json:"window_gauges"`
+}
+
+func (m *ClientMetrics) Settings() ClientSettings {
+	c := m.config()
+	return ClientSettings{
+		HandlingTimeHistogram: c.handling != nil,
+		TerminationLabel:      c.termination,
+		WindowStats:           c.windows != nil,
+		WindowGauges:          c.windows.gaugesEnabled(),
+	}
+}
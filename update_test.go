@@ -0,0 +1,82 @@
+package grpcmetrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"google.golang.org/grpc"
+)
+
+func TestServerMetrics_Update(t *testing.T) {
+	m := newServerMetrics()
+	call := func() {
+		if _, err := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	call()
+	m.Update(WithServerHandlingTimeHistogram(true), WithServerTerminationLabel(true))
+	call()
+	if s := m.Settings(); !s.HandlingTimeHistogram || !s.TerminationLabel || s.PanicsCounter {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+	m.Update(WithServerHandlingTimeHistogram(false))
+	call()
+	m.Update(WithServerHandlingTimeHistogram(true))
+	call()
+	checkContains(t, vmSet(m.s),
+		`grpc_server_started_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 4`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK"} 1`,
+		`grpc_server_handled_total{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",grpc_code="OK",grpc_termination="completed"} 3`,
+		`grpc_server_handling_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 2`,
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i == 0 {
+					m.Update(WithServerPanicsCounter(j%2 == 0), WithServerWindowGauges(j%3 == 0))
+				} else {
+					call()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestServerMetrics_Update_disabledExported(t *testing.T) {
+	m := newServerMetrics(WithServerHandlingTimeHistogram(true), WithServerPanicsCounter(true))
+	callUnary(context.Background(), m)
+	m.Update(WithServerHandlingTimeHistogram(false), WithServerPanicsCounter(false))
+
+	checkContains(t, vmSet(m.s),
+		`grpc_server_handling_seconds_count{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 1`,
+	)
+	checkExposed(t, m, "grpc_server_handling_seconds")
+	for _, s := range m.Snapshot() {
+		if s.FullMethod() == "/grpc.health.v1.Health/Check" && (s.Handling == nil || s.Handling.Count != 1) {
+			t.Fatalf("disabled histogram isn't in the snapshot: %+v", s.Handling)
+		}
+	}
+}
+
+func TestServerMetrics_Update_static(t *testing.T) {
+	m := newServerMetrics()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	m.Update(WithServerMetricsSet(metrics.NewSet()))
+}
@@ -0,0 +1,371 @@
+package grpcmetrics
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amenzhinsky/grpcmetrics/internal/promfmt"
+	"google.golang.org/grpc/codes"
+)
+
+// Windows are the sliding windows exposed as gauges, WindowStats
+// accepts any window up to the longest one with a second precision.
+var Windows = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+// WindowQuantiles are the handling time quantiles exposed as gauges.
+var WindowQuantiles = []float64{0.5, 0.9, 0.99}
+
+const (
+	windowSlots = 300 // seconds, the longest window
+
+	// latency buckets upper bounds are 100µs*2^i, the last one is +Inf.
+	latencyBuckets = 24
+	latencyBase    = 100 * time.Microsecond
+)
+
+// WithServerWindowStats records sliding window statistics of calls available via WindowStats,
+// disabling them unregisters window gauges as well.
+func WithServerWindowStats(enable bool) ServerOption {
+	return func(m *ServerMetrics) {
+		if !enable {
+			m.next.windows = nil
+			m.windows.setGauges(false)
+			return
+		}
+		m.next.windows = m.windowStats()
+	}
+}
+
+// WithServerWindowGauges enables window statistics and exposes them as
+// grpc_server_requests_rate_<window>, grpc_server_error_ratio_<window>
+// and grpc_server_handling_seconds_<window> with quantile label gauges,
+// disabling them unregisters gauges, window statistics remain enabled.
+func WithServerWindowGauges(enable bool) ServerOption {
+	return func(m *ServerMetrics) {
+		if !enable {
+			m.windows.setGauges(false)
+			return
+		}
+		m.next.windows = m.windowStats()
+		m.windows.setGauges(true)
+	}
+}
+
+func (m *ServerMetrics) windowStats() *windows {
+	if m.windows == nil {
+		m.windows = newWindows("grpc_server")
+		m.expirer.trackWindows(m.windows)
+	}
+	return m.windows
+}
+
+// WithClientWindowStats is the client version of WithServerWindowStats.
+func WithClientWindowStats(enable bool) ClientOption {
+	return func(m *ClientMetrics) {
+		if !enable {
+			m.next.windows = nil
+			m.windows.setGauges(false)
+			return
+		}
+		m.next.windows = m.windowStats()
+	}
+}
+
+// WithClientWindowGauges is the client version of WithServerWindowGauges.
+func WithClientWindowGauges(enable bool) ClientOption {
+	return func(m *ClientMetrics) {
+		if !enable {
+			m.windows.setGauges(false)
+			return
+		}
+		m.next.windows = m.windowStats()
+		m.windows.setGauges(true)
+	}
+}
+
+func (m *ClientMetrics) windowStats() *windows {
+	if m.windows == nil {
+		m.windows = newWindows("grpc_client")
+		m.expirer.trackWindows(m.windows)
+	}
+	return m.windows
+}
+
+// WindowStats returns statistics of calls to the method handled in the
+// given window, it's false when window stats are disabled or there were no calls.
+func (m *ServerMetrics) WindowStats(fullMethod string, window time.Duration) (WindowStats, bool) {
+	return m.config().windows.stats(fullMethod, window, time.Now())
+}
+
+// WindowStats returns statistics of calls to the method finished in the
+// given window, it's false when window stats are disabled or there were no calls.
+func (m *ClientMetrics) WindowStats(fullMethod string, window time.Duration) (WindowStats, bool) {
+	return m.config().windows.stats(fullMethod, window, time.Now())
+}
+
+// WindowStats contains statistics of calls of a single method over a sliding window.
+type WindowStats struct {
+	Window   time.Duration
+	Requests uint64
+	Errors   uint64
+	Handling *HistogramStats
+}
+
+// Rate returns the number of requests per second.
+func (s WindowStats) Rate() float64 {
+	return float64(s.Requests) / s.Window.Seconds()
+}
+
+// ErrorRatio returns the ratio of calls finished with non-OK codes, it's NaN with no calls.
+func (s WindowStats) ErrorRatio() float64 {
+	if s.Requests == 0 {
+		return math.NaN()
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+type windows struct {
+	mu      sync.RWMutex
+	methods map[string]*window
+	prefix  string
+	gauges  bool
+	s       Backend // assigned after options are applied
+}
+
+func newWindows(prefix string) *windows {
+	return &windows{
+		methods: map[string]*window{},
+		prefix:  prefix,
+	}
+}
+
+// setGauges enables or disables registering gauges of new methods,
+// gauges of already known methods are registered or unregistered as well.
+func (w *windows) setGauges(enable bool) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.gauges = enable
+	for method, win := range w.methods {
+		switch {
+		case enable && !win.gauges:
+			w.registerGauges(win.typ, method)
+		case !enable && win.gauges:
+			w.unregisterGauges(win.typ, method)
+		}
+		win.gauges = enable
+	}
+}
+
+func (w *windows) gaugesEnabled() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.gauges
+}
+
+type window struct {
+	typ    string
+	gauges bool // guarded by windows.mu
+
+	mu    sync.Mutex
+	slots [windowSlots]windowSlot
+}
+
+type windowSlot struct {
+	sec      int64
+	requests uint64
+	errors   uint64
+	latency  [latencyBuckets]uint32
+}
+
+func (w *windows) observe(typ, method string, code codes.Code, startedAt time.Time) {
+	now := time.Now()
+	win := w.get(typ, method)
+	win.mu.Lock()
+	s := win.slot(now.Unix())
+	s.requests++
+	if code != codes.OK {
+		s.errors++
+	}
+	s.latency[latencyBucket(now.Sub(startedAt))]++
+	win.mu.Unlock()
+}
+
+func (w *windows) get(typ, method string) *window {
+	w.mu.RLock()
+	win, ok := w.methods[method]
+	w.mu.RUnlock()
+	if ok {
+		return win
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if win, ok = w.methods[method]; ok {
+		return win
+	}
+	win = &window{typ: typ}
+	w.methods[method] = win
+	if w.gauges {
+		w.registerGauges(typ, method)
+		win.gauges = true
+	}
+	return win
+}
+
+func (w *windows) registerGauges(typ, method string) {
+	for _, d := range Windows {
+		d := d
+		suffix := "_" + promfmt.Duration(d)
+		stats := func() WindowStats {
+			s, _ := w.stats(method, d, time.Now())
+			return s
+		}
+		w.s.Gauge(w.prefix+"_requests_rate"+suffix, methodLabels(typ, method, noCode, ""), func() float64 {
+			return stats().Rate()
+		})
+		w.s.Gauge(w.prefix+"_error_ratio"+suffix, methodLabels(typ, method, noCode, ""), func() float64 {
+			return stats().ErrorRatio()
+		})
+		for _, q := range WindowQuantiles {
+			q := q
+			labels := `quantile="` + strconv.FormatFloat(q, 'f', -1, 64) + `"`
+			w.s.Gauge(w.prefix+"_handling_seconds"+suffix, methodLabels(typ, method, noCode, labels), func() float64 {
+				return stats().Handling.Quantile(q)
+			})
+		}
+	}
+}
+
+// expire removes windows of methods without calls since the given time,
+// it returns the number of unregistered gauges.
+func (w *windows) expire(since time.Time) int {
+	deadline := since.Unix()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var n int
+	for method, win := range w.methods {
+		if win.lastSec() >= deadline {
+			continue
+		}
+		if win.gauges {
+			n += w.unregisterGauges(win.typ, method)
+		}
+		delete(w.methods, method)
+	}
+	return n
+}
+
+func (w *windows) unregisterGauges(typ, method string) int {
+	var n int
+	for _, d := range Windows {
+		suffix := "_" + promfmt.Duration(d)
+		w.s.Unregister(w.prefix+"_requests_rate"+suffix, methodLabels(typ, method, noCode, ""))
+		w.s.Unregister(w.prefix+"_error_ratio"+suffix, methodLabels(typ, method, noCode, ""))
+		for _, q := range WindowQuantiles {
+			labels := `quantile="` + strconv.FormatFloat(q, 'f', -1, 64) + `"`
+			w.s.Unregister(w.prefix+"_handling_seconds"+suffix, methodLabels(typ, method, noCode, labels))
+		}
+		n += 2 + len(WindowQuantiles)
+	}
+	return n
+}
+
+func (w *windows) stats(method string, d time.Duration, now time.Time) (WindowStats, bool) {
+	if w == nil {
+		return WindowStats{}, false
+	}
+	w.mu.RLock()
+	win, ok := w.methods[method]
+	w.mu.RUnlock()
+	if !ok {
+		return WindowStats{}, false
+	}
+	n := int64(d / time.Second)
+	if n < 1 {
+		n = 1
+	} else if n > windowSlots {
+		n = windowSlots
+	}
+
+	var latency [latencyBuckets]uint64
+	s := WindowStats{Window: time.Duration(n) * time.Second}
+	sec := now.Unix()
+	win.mu.Lock()
+	for i := range win.slots {
+		slot := &win.slots[i]
+		if slot.sec <= sec-n || slot.sec > sec {
+			continue
+		}
+		s.Requests += slot.requests
+		s.Errors += slot.errors
+		for j, c := range slot.latency {
+			latency[j] += uint64(c)
+		}
+	}
+	win.mu.Unlock()
+
+	s.Handling = &HistogramStats{}
+	for i, c := range latency {
+		if c == 0 {
+			continue
+		}
+		s.Handling.Count += c
+		s.Handling.Buckets = append(s.Handling.Buckets, BucketStats{
+			Lower: latencyBound(i - 1),
+			Upper: latencyBound(i),
+			Count: c,
+		})
+	}
+	return s, true
+}
+
+// lastSec returns the last second with calls.
+func (w *window) lastSec() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var sec int64
+	for i := range w.slots {
+		if w.slots[i].sec > sec {
+			sec = w.slots[i].sec
+		}
+	}
+	return sec
+}
+
+// slot returns the slot of the given second resetting it if it's stale.
+func (w *window) slot(sec int64) *windowSlot {
+	s := &w.slots[sec%windowSlots]
+	if s.sec != sec {
+		*s = windowSlot{sec: sec}
+	}
+	return s
+}
+
+func latencyBucket(d time.Duration) int {
+	for i := 0; i < latencyBuckets-1; i++ {
+		if d <= latencyBase<<i {
+			return i
+		}
+	}
+	return latencyBuckets - 1
+}
+
+// latencyBound returns the upper bound of the i-th bucket in seconds.
+func latencyBound(i int) float64 {
+	switch {
+	case i < 0:
+		return 0
+	case i >= latencyBuckets-1:
+		return math.Inf(1)
+	default:
+		return (latencyBase << i).Seconds()
+	}
+}
@@ -0,0 +1,82 @@
+package grpcmetrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithServerWindowStats(t *testing.T) {
+	m := newServerMetrics(
+		WithServerWindowGauges(true),
+	)
+	for _, err := range []error{nil, nil, status.Error(codes.Unavailable, "unavailable"), nil} {
+		if _, e := UnaryServerInterceptor(m)(context.Background(), nil, &grpc.UnaryServerInfo{
+			FullMethod: "/grpc.health.v1.Health/Check",
+		}, func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		}); e != err {
+			t.Fatal(e)
+		}
+	}
+
+	s, ok := m.WindowStats("/grpc.health.v1.Health/Check", time.Minute)
+	if !ok {
+		t.Fatal("no window stats")
+	}
+	if s.Requests != 4 || s.Errors != 1 || s.ErrorRatio() != 0.25 || s.Handling.Count != 4 {
+		t.Fatalf("unexpected window stats: %+v", s)
+	}
+	if rate := s.Rate(); rate != 4.0/60 {
+		t.Fatalf("rate = %f, want %f", rate, 4.0/60)
+	}
+	if q := s.Handling.Quantile(0.99); q <= 0 || q > 0.1 {
+		t.Fatalf("p99 = %f", q)
+	}
+	if s, _ := m.windows.stats("/grpc.health.v1.Health/Check", 10*time.Second,
+		time.Now().Add(20*time.Second)); s.Requests != 0 {
+		t.Fatalf("requests outside of the window are counted: %+v", s)
+	}
+	if _, ok := m.WindowStats("/grpc.health.v1.Health/Watch", time.Minute); ok {
+		t.Fatal("window stats of a method without calls")
+	}
+	checkContains(t, vmSet(m.s),
+		`grpc_server_error_ratio_1m{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0.25`,
+		`grpc_server_requests_rate_10s{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0.4`,
+		`grpc_server_handling_seconds_5m{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check",quantile="0.99"} `,
+	)
+
+	m.Update(WithServerWindowGauges(false))
+	var b bytes.Buffer
+	vmSet(m.s).WritePrometheus(&b)
+	if strings.Contains(b.String(), "_1m{") {
+		t.Fatalf("window gauges aren't unregistered:\n%s", b.String())
+	}
+	if _, ok := m.WindowStats("/grpc.health.v1.Health/Check", time.Minute); !ok {
+		t.Fatal("window stats are disabled with gauges")
+	}
+	m.Update(WithServerWindowGauges(true))
+	checkContains(t, vmSet(m.s),
+		`grpc_server_error_ratio_1m{grpc_type="unary",grpc_service="grpc.health.v1.Health",grpc_method="Check"} 0.25`,
+	)
+}
+
+func TestLatencyBucket(t *testing.T) {
+	for d, want := range map[time.Duration]int{
+		0:                      0,
+		100 * time.Microsecond: 0,
+		150 * time.Microsecond: 1,
+		time.Second:            14,
+		time.Hour:              latencyBuckets - 1,
+	} {
+		if got := latencyBucket(d); got != want {
+			t.Errorf("latencyBucket(%s) = %d, want %d", d, got, want)
+		}
+	}
+}